@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nochso/rss/sanitize"
+)
+
+// atomFeed is an Atom 1.0 document served by rssd.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Links     []atomLink   `xml:"link"`
+	Author    atomAuthor   `xml:"author"`
+	Source    *atomSource  `xml:"source,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomSource struct {
+	Title string `xml:"title"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// writeAtom writes items as an Atom feed. Entry IDs are the URLs of the
+// items on rssd, as GUIDs of the original feeds are not always IRIs.
+func writeAtom(w io.Writer, base *url.URL, title, self, hub string, items []publishedItem) error {
+	f := atomFeed{
+		ID:    self,
+		Title: title,
+		Links: []atomLink{{Rel: "self", Href: self}, {Rel: "hub", Href: hub}},
+	}
+	updated := time.Time{}
+	for _, it := range items {
+		if it.Updated.After(updated) {
+			updated = it.Updated
+		}
+		e := atomEntry{
+			ID:        base.ResolveReference(&url.URL{Path: "item/" + strconv.FormatInt(it.ID, 10)}).String(),
+			Title:     it.Title,
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Updated:   it.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: it.Author},
+		}
+		if e.Author.Name == "" {
+			// required by Atom if the feed has no author
+			e.Author.Name = it.FeedTitle
+		}
+		if it.Link != "" {
+			e.Links = []atomLink{{Rel: "alternate", Href: it.Link}}
+		}
+		if it.FeedTitle != "" {
+			e.Source = &atomSource{Title: it.FeedTitle}
+		}
+		if it.Body != "" {
+			// resolve paths on rssd, e.g. of mail attachments
+			e.Content = &atomContent{Type: "html", Body: sanitize.HTML(it.Body, base)}
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	f.Updated = updated.UTC().Format(time.RFC3339)
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(f)
+}
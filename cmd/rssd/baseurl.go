@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// publicURL returns the root URL of rssd as seen by clients: -base-url if
+// set, otherwise the host of the request.
+func publicURL(r *http.Request) *url.URL {
+	if u, ok := configuredBaseURL(); ok {
+		return u
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: "/"}
+}
+
+// configuredBaseURL returns -base-url with a trailing slash, or false if it
+// is not set.
+func configuredBaseURL() (*url.URL, bool) {
+	if baseURL == "" {
+		return nil, false
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, false
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, true
+}
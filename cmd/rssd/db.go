@@ -8,8 +8,9 @@ import (
 )
 
 func openDB(fpath string) (*sql.DB, error) {
-	// use write-ahead log and wait 10s when locked
-	dsn := "file:" + fpath + "?_journal=WAL&_synchronous=NORMAL&_busy_timeout=10000"
+	// use write-ahead log and wait 10s when locked.
+	// foreign keys must be enabled for every connection of the pool.
+	dsn := "file:" + fpath + "?_journal=WAL&_synchronous=NORMAL&_busy_timeout=10000&_foreign_keys=on"
 	log.WithField("dsn", dsn).
 		WithField("file", fpath).
 		Debug("opening db")
@@ -17,10 +18,6 @@ func openDB(fpath string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.Exec(`PRAGMA foreign_keys = on;`)
-	if err != nil {
-		return nil, err
-	}
 	err = migrateDB(db)
 	if err != nil {
 		db.Close()
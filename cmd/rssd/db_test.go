@@ -0,0 +1,29 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDB returns a migrated db in a temporary directory that is removed
+// when the test ends.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB(filepath.Join(dir, "rss.sqlite3"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	return db
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/extract"
+	"github.com/nochso/rss/sanitize"
+	"golang.org/x/net/html/charset"
+)
+
+// extractBatch is the maximum amount of articles extracted per fetch of a
+// feed.
+const extractBatch = 10
+
+// maxArticleSize is the maximum amount of bytes read from an article page.
+const maxArticleSize = 5 << 20
+
+// maxArticlePages is the maximum amount of pages of a multi-page article.
+const maxArticlePages = 10
+
+// extractQueue is the maximum amount of feeds waiting for extraction.
+const extractQueue = 100
+
+// extractTimeout limits the time spent extracting the articles of a feed.
+// Remaining items are extracted after the next fetch of the feed.
+const extractTimeout = 2 * time.Minute
+
+// pendingItem is an item whose article has not been extracted yet.
+type pendingItem struct {
+	id       int64
+	link     string
+	feedLink string
+}
+
+// queueExtraction hands a fetched feed to the extraction worker, so slow
+// article pages don't hold up the fetch workers. If the queue is full the
+// items are left for the next fetch of the feed.
+func (f *fetcher) queueExtraction(l *log.Entry, feedID int64) {
+	select {
+	case f.extractions <- feedID:
+	default:
+		l.Debug("extraction queue is full")
+	}
+}
+
+// extractLoop extracts the articles of queued feeds one feed at a time until
+// ctx is cancelled.
+func (f *fetcher) extractLoop(ctx context.Context) {
+	defer close(f.extractDone)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-f.extractions:
+			f.extractArticles(ctx, log.WithField("feed_id", id), id)
+		}
+	}
+}
+
+// extractArticles downloads the pages of new items of a feed and extracts
+// their articles, if any subscriber of the feed wants the full content.
+// It gives up after extractTimeout.
+func (f *fetcher) extractArticles(ctx context.Context, l *log.Entry, feedID int64) {
+	ctx, cancel := context.WithTimeout(ctx, extractTimeout)
+	defer cancel()
+	items, err := pendingExtractions(f.db, feedID, extractBatch)
+	if err != nil {
+		l.WithError(err).Error("selecting items for extraction")
+		return
+	}
+	for _, item := range items {
+		il := l.WithField("item_id", item.id).WithField("link", item.link)
+		raw, final, err := f.fetchArticle(ctx, item.link)
+		if ctx.Err() == context.DeadlineExceeded {
+			l.Info("article extraction timed out")
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			il.WithError(err).Info("extracting article")
+		}
+		err = storeExtraction(f.db, item, raw, final, err, time.Now().UTC())
+		if err != nil {
+			il.WithError(err).Error("storing extracted article")
+		}
+	}
+	if len(items) > 0 {
+		l.WithField("items", len(items)).Debug("articles extracted")
+	}
+}
+
+// fetchArticle downloads a web page and returns the HTML of its main article
+// and the final URL of the page. An extraction rule for the host of the page
+// is preferred over the heuristics of extract.Article.
+func (f *fetcher) fetchArticle(ctx context.Context, link string) (string, string, error) {
+	page, final, err := f.fetchPage(ctx, link)
+	if err != nil {
+		return "", "", err
+	}
+	rule, err := findRule(f.db, final.Hostname())
+	if err != nil {
+		return "", "", err
+	}
+	if rule != nil {
+		article, err := f.extractByRule(ctx, page, final, rule.Rule)
+		if err == nil {
+			return article, final.String(), nil
+		}
+		log.WithError(err).
+			WithField("host", rule.Host).
+			WithField("link", final.String()).
+			Info("extraction rule failed, falling back to heuristics")
+	}
+	article, err := extract.Article(bytes.NewReader(page), final)
+	return article, final.String(), err
+}
+
+// extractByRule extracts the article from page and follows its next page
+// links. Pages that fail to download are skipped along with the rest of the
+// article.
+func (f *fetcher) extractByRule(ctx context.Context, page []byte, u *url.URL, rule extract.Rule) (string, error) {
+	var article strings.Builder
+	seen := map[string]bool{u.String(): true}
+	for i := 0; i < maxArticlePages; i++ {
+		part, next, err := extract.ByRule(bytes.NewReader(page), u, rule)
+		if err != nil {
+			if i == 0 {
+				return "", err
+			}
+			break
+		}
+		article.WriteString(part)
+		if next == "" || seen[next] {
+			break
+		}
+		seen[next] = true
+		page, u, err = f.fetchPage(ctx, next)
+		if err != nil {
+			break
+		}
+	}
+	return article.String(), nil
+}
+
+// fetchPage downloads a HTML page. It returns the page transcoded to UTF-8
+// and its final URL.
+func (f *fetcher) fetchPage(ctx context.Context, link string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil && mt != "text/html" && mt != "application/xhtml+xml" {
+		return nil, nil, fmt.Errorf("unsupported content type %q", mt)
+	}
+	r, err := charset.NewReader(io.LimitReader(resp.Body, maxArticleSize), contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return page, resp.Request.URL, nil
+}
+
+// pendingExtractions returns the newest items of a feed that have a link but
+// no extracted article yet. Nothing is returned unless a subscription of the
+// feed has full content enabled.
+func pendingExtractions(db *sql.DB, feedID int64, limit int) ([]pendingItem, error) {
+	rows, err := db.Query(`
+SELECT i.id, i.link, COALESCE(f.link, '')
+  FROM feed_item i
+  JOIN feed f ON f.id = i.feed_id
+ WHERE i.feed_id = ?
+   AND i.extracted_at IS NULL
+   AND COALESCE(i.link, '') != ''
+   AND EXISTS (SELECT 1 FROM subscription s WHERE s.feed_id = i.feed_id AND s.full_content = 1)
+ ORDER BY i.published DESC
+ LIMIT ?`, feedID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pendingItem
+	for rows.Next() {
+		var item pendingItem
+		err = rows.Scan(&item.id, &item.link, &item.feedLink)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// storeExtraction stores the extracted article of an item or the reason the
+// extraction failed. Failed extractions are not retried.
+func storeExtraction(db *sql.DB, item pendingItem, raw, final string, extractErr error, now time.Time) error {
+	var errMsg interface{}
+	if extractErr != nil {
+		raw = ""
+		errMsg = extractErr.Error()
+	}
+	if final == "" {
+		final = item.link
+	}
+	_, err := db.Exec(`
+UPDATE feed_item
+   SET extracted = ?,
+       extracted_html = ?,
+       extracted_at = ?,
+       extract_error = ?
+ WHERE id = ?`,
+		nullString(raw),
+		nullString(sanitize.HTML(raw, itemBase(final, item.feedLink))),
+		now,
+		errMsg,
+		item.id,
+	)
+	return err
+}
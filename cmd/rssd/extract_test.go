@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const testArticle = `<!DOCTYPE html>
+<html><body>
+<nav><a href="/">Home</a></nav>
+<div class="post">
+<p>The article is extracted by a separate worker, so the fetch workers can move on to the next feed right away.</p>
+<p>A slow article page, with ten items in a feed and a timeout of thirty seconds each, used to block a fetch worker for minutes.</p>
+<p>Extraction is now limited per feed as well, and the remaining items are picked up after the next fetch of the feed.</p>
+</div>
+</body></html>`
+
+func TestExtractionDoesNotBlockFetch(t *testing.T) {
+	db := testDB(t)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title><link>http://%s/</link>
+<item><title>Slow</title><link>http://%[1]s/article</link></item>
+</channel></rss>`, r.Host)
+		case "/article":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, testArticle)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(db)
+	f.client = srv.Client()
+	feedID := subscribeTestFeed(t, db, srv.URL+"/feed.xml")
+	_, err := db.Exec(`UPDATE subscription SET full_content = 1 WHERE feed_id = ?`, feedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feeds, err := f.selectDue(time.Now())
+	if err != nil || len(feeds) != 1 {
+		t.Fatalf("selecting due feed: %v %v", feeds, err)
+	}
+	fetched := make(chan struct{})
+	go func() {
+		defer close(fetched)
+		f.fetchOne(context.Background(), feeds[0])
+	}()
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch is blocked by the article page")
+	}
+	var queued int64
+	select {
+	case queued = <-f.extractions:
+	default:
+		t.Fatal("feed was not queued for extraction")
+	}
+	if queued != feedID {
+		t.Fatalf("queued feed %d, want %d", queued, feedID)
+	}
+
+	close(release)
+	f.extractArticles(context.Background(), log.WithField("feed_id", queued), queued)
+	var extracted string
+	err = db.QueryRow(`SELECT COALESCE(extracted_html, '') FROM feed_item WHERE feed_id = ?`, feedID).Scan(&extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(extracted, "separate worker") || strings.Contains(extracted, "Home") {
+		t.Errorf("extracted article:\n%s", extracted)
+	}
+}
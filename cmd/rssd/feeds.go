@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+)
+
+// feedView is a feed and its update status prepared for rendering.
+type feedView struct {
+	ID          int64
+	Title       string
+	Link        string
+	FeedLink    string
+	LastSuccess *time.Time
+	NextFetch   *time.Time
+	HTTPStatus  int
+	ErrorCount  int
+	LastError   string
+	Disabled    bool
+	Warnings    []string // problems of the last document
+	Kind        string   // see kindFeed
+	// Subscribed is true if the user is subscribed to the feed.
+	Subscribed bool
+	// FullContent is true if articles are extracted from item links.
+	FullContent bool
+	// Tags of the user's subscription.
+	Tags []tagView
+}
+
+// TagList returns the tags as comma separated list.
+func (f feedView) TagList() string {
+	names := make([]string, len(f.Tags))
+	for i, t := range f.Tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// IsScraped returns true if the items are scraped from a web page.
+func (f feedView) IsScraped() bool {
+	return f.Kind == kindScrape
+}
+
+// IsMonitor returns true if the items are changes of a web page.
+func (f feedView) IsMonitor() bool {
+	return f.Kind == kindMonitor
+}
+
+// IsJSON returns true if the items are mapped from a JSON document.
+func (f feedView) IsJSON() bool {
+	return f.Kind == kindJSON
+}
+
+// IsMail returns true if the items are newsletters received by mail.
+func (f feedView) IsMail() bool {
+	return f.Kind == kindMail
+}
+
+// Broken returns true if the last update of the feed failed.
+func (f feedView) Broken() bool {
+	return f.Disabled || f.ErrorCount > 0
+}
+
+func handleFeeds(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feeds, err := allFeeds(db, userID(r))
+		if err != nil {
+			log.WithError(err).Error("selecting feeds")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		render(w, r, "feeds.html", feeds)
+	}
+}
+
+// handleFeedEnable re-enables a feed and schedules it immediately.
+func handleFeedEnable(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, err = db.Exec(`
+UPDATE feed
+   SET disabled = 0,
+       error_count = 0,
+       next_fetch = NULL
+ WHERE id = ?`, id)
+		if err != nil {
+			log.WithError(err).WithField("feed_id", id).Error("enabling feed")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+// handleFullContent turns the extraction of articles on or off for the
+// subscription of the user. Enabling it schedules the feed immediately.
+func handleFullContent(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		enabled := r.PostFormValue("full_content") == "1"
+		err = setFullContent(db, userID(r), id, enabled)
+		if err != nil {
+			log.WithError(err).WithField("feed_id", id).Error("changing full content option")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+func setFullContent(db *sql.DB, userID, feedID int64, enabled bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE subscription SET full_content = ? WHERE user_id = ? AND feed_id = ?`,
+		enabled,
+		userID,
+		feedID,
+	)
+	if err == nil && enabled {
+		_, err = tx.Exec(`UPDATE feed SET next_fetch = NULL WHERE id = ?`, feedID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// allFeeds returns all feeds with broken ones first, including the
+// subscription options of the given user.
+func allFeeds(db *sql.DB, userID int64) ([]feedView, error) {
+	rows, err := db.Query(`
+SELECT f.id, f.title, COALESCE(f.link, ''), f.feed_link, f.last_success, f.next_fetch,
+       COALESCE(f.http_status, 0), f.error_count, COALESCE(f.last_error, ''), f.disabled,
+       COALESCE(f.parse_warnings, ''), f.kind, s.id IS NOT NULL, COALESCE(s.full_content, 0)
+  FROM feed f
+  LEFT JOIN subscription s ON s.feed_id = f.id AND s.user_id = ?
+ ORDER BY f.disabled DESC, f.error_count > 0 DESC, f.title COLLATE NOCASE`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags, err := subscriptionTags(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var feeds []feedView
+	for rows.Next() {
+		var f feedView
+		var warnings string
+		err = rows.Scan(
+			&f.ID,
+			&f.Title,
+			&f.Link,
+			&f.FeedLink,
+			&f.LastSuccess,
+			&f.NextFetch,
+			&f.HTTPStatus,
+			&f.ErrorCount,
+			&f.LastError,
+			&f.Disabled,
+			&warnings,
+			&f.Kind,
+			&f.Subscribed,
+			&f.FullContent,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if warnings != "" {
+			f.Warnings = strings.Split(warnings, "\n")
+		}
+		if isPageKind(f.Kind) {
+			f.FeedLink = pageURL(f.FeedLink)
+		}
+		f.Tags = tags[f.ID]
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
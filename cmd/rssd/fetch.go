@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/feed"
+)
+
+// userAgent is sent with every request made by the fetcher.
+const userAgent = "rssd (+https://github.com/nochso/rss)"
+
+// fetchBatch is the maximum amount of due feeds selected at once.
+const fetchBatch = 100
+
+// maxFeedSize is the maximum size of a downloaded feed document.
+const maxFeedSize = 10 << 20
+
+// fetcher periodically downloads all feeds that are due and stores their
+// items.
+type fetcher struct {
+	db      *sql.DB
+	client  *http.Client
+	sched   schedule
+	poll    time.Duration // time between checks for due feeds
+	workers int
+	// consecutive failures after which a feed is disabled, zero to never
+	// disable feeds
+	maxFailures int
+	// consecutive fetches a new URL must be seen before a feed is moved
+	moveAfter int
+	// websub subscribes feeds to their hubs, nil if push is disabled
+	websub *subscriber
+	// hub notifies subscribers of tag feeds about new items, may be nil
+	hub *hub
+	// feeds whose articles are waiting to be extracted
+	extractions chan int64
+
+	cancel      context.CancelFunc
+	done        chan struct{}
+	extractDone chan struct{}
+	once        sync.Once
+}
+
+// dueFeed is a feed selected for fetching.
+type dueFeed struct {
+	id    int64
+	link  string
+	kind  string
+	cache httpCache // validators of the previous response
+}
+
+// Kinds of feeds, i.e. how a feed is turned into items.
+const (
+	kindFeed    = "feed"    // RSS, Atom or JSON Feed
+	kindScrape  = "scrape"  // web page with items selected by scrape.Config
+	kindMonitor = "monitor" // web page with an item for each change
+	kindJSON    = "json"    // JSON document mapped by jsonmap.Config
+	kindMail    = "mail"    // newsletters received by mail, never fetched
+)
+
+// parseFunc turns a response body into a feed, e.g. feed.Parse.
+type parseFunc func(r io.Reader, contentType string, base *url.URL) (*feed.Feed, error)
+
+// httpCache holds the validators, status and hints of a HTTP response.
+type httpCache struct {
+	etag         string
+	lastModified string
+	status       int
+	maxAge       time.Duration
+	retryAfter   time.Duration
+	movedTo      string // target of permanent redirects
+	hub          string // WebSub hub stated by the Link header
+	self         string // feed URL stated by the Link header
+}
+
+func newFetcher(db *sql.DB) *fetcher {
+	return &fetcher{
+		db:     db,
+		client: &http.Client{Timeout: fetchTimeout},
+		sched: schedule{
+			def: fetchInterval,
+			min: fetchMin,
+			max: fetchMax,
+		},
+		poll:        time.Minute,
+		workers:     fetchWorkers,
+		maxFailures: fetchMaxFailures,
+		moveAfter:   fetchMoveAfter,
+		extractions: make(chan int64, extractQueue),
+		done:        make(chan struct{}),
+		extractDone: make(chan struct{}),
+	}
+}
+
+// start the background loop. It keeps running until stop is called.
+func (f *fetcher) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	log.WithField("interval", f.sched.def).
+		WithField("min", f.sched.min).
+		WithField("max", f.sched.max).
+		WithField("workers", f.workers).
+		Info("feed fetcher starting")
+	go f.loop(ctx)
+	go f.extractLoop(ctx)
+}
+
+// stop cancels pending downloads and blocks until feeds and articles that
+// are already being written to the db are done.
+func (f *fetcher) stop() {
+	f.once.Do(func() {
+		log.Info("stopping feed fetcher")
+		f.cancel()
+		<-f.done
+		<-f.extractDone
+		log.Info("feed fetcher stopped")
+	})
+}
+
+func (f *fetcher) loop(ctx context.Context) {
+	defer close(f.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		n, err := f.fetchDue(ctx)
+		if err != nil {
+			log.WithError(err).Error("fetching due feeds")
+		}
+		if f.websub != nil {
+			f.websub.renewDue(ctx, time.Now().UTC())
+		}
+		if f.hub != nil {
+			f.hub.notify(ctx, time.Now().UTC())
+		}
+		if n == fetchBatch {
+			// there are probably more feeds waiting
+			timer.Reset(0)
+		} else {
+			timer.Reset(f.poll)
+		}
+	}
+}
+
+// fetchDue downloads and stores a single batch of due feeds using a bounded
+// amount of workers. It returns the amount of feeds in the batch.
+func (f *fetcher) fetchDue(ctx context.Context) (int, error) {
+	feeds, err := f.selectDue(time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	if len(feeds) == 0 {
+		return 0, nil
+	}
+	log.WithField("count", len(feeds)).Debug("fetching due feeds")
+	jobs := make(chan dueFeed)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < f.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for df := range jobs {
+				f.fetchOne(ctx, df)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+	for _, df := range feeds {
+		select {
+		case <-ctx.Done():
+			return len(feeds), nil
+		case jobs <- df:
+		}
+	}
+	return len(feeds), nil
+}
+
+// selectDue returns feeds that have never been fetched or are scheduled to be
+// fetched before the given time, most overdue first.
+func (f *fetcher) selectDue(before time.Time) ([]dueFeed, error) {
+	rows, err := f.db.Query(`
+SELECT id, feed_link, kind, COALESCE(etag, ''), COALESCE(last_modified, '')
+  FROM feed
+ WHERE disabled = 0
+   AND kind != ?
+   AND (next_fetch IS NULL OR next_fetch <= ?)
+ ORDER BY next_fetch
+ LIMIT ?`, kindMail, before, fetchBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var feeds []dueFeed
+	for rows.Next() {
+		var df dueFeed
+		err = rows.Scan(&df.id, &df.link, &df.kind, &df.cache.etag, &df.cache.lastModified)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, df)
+	}
+	return feeds, rows.Err()
+}
+
+func (f *fetcher) fetchOne(ctx context.Context, df dueFeed) {
+	l := log.WithField("feed_id", df.id).WithField("feed_link", df.link)
+	start := time.Now()
+	var doc *feed.Feed
+	var cache httpCache
+	parse, err := f.parser(df)
+	if err == nil {
+		doc, cache, err = f.download(ctx, df.link, df.cache, parse)
+	}
+	if ctx.Err() != nil {
+		// shutting down: try again next time
+		return
+	}
+	now := time.Now().UTC()
+	if err != nil {
+		l.WithError(err).Warn("fetching feed")
+		f.backoff(l, df.id, cache, err, now)
+		return
+	}
+	if doc == nil {
+		err = touchFeed(f.db, df.id, cache.status, now)
+		if err == nil {
+			l.WithField("duration", time.Since(start)).Debug("feed not modified")
+		}
+	} else {
+		if len(doc.Warnings) > 0 {
+			l.WithField("warnings", strings.Join(doc.Warnings, "; ")).Info("repaired malformed feed")
+		}
+		err = storeFeed(f.db, df.id, doc, cache, now)
+		if err == nil {
+			l.WithField("items", len(doc.Items)).
+				WithField("duration", time.Since(start)).
+				Debug("feed updated")
+		}
+	}
+	if err != nil {
+		l.WithError(err).Error("storing feed")
+	}
+	next, err := scheduleFeed(f.db, f.sched, df.id, cache, now)
+	if err != nil {
+		l.WithError(err).Error("scheduling feed")
+		return
+	}
+	l.WithField("next_fetch", next).Debug("feed scheduled")
+	if f.websub != nil && doc != nil && df.kind == kindFeed {
+		hub, topic := pushLinks(df.link, cache, doc)
+		f.websub.update(ctx, l, df.id, hub, topic, now)
+	}
+	f.queueExtraction(l, df.id)
+	if doc != nil || cache.movedTo != "" {
+		f.move(ctx, l, df, cache, doc)
+	}
+}
+
+// move updates the URL of a feed once the same new URL was seen by enough
+// consecutive fetches. URLs stated by the document itself must point to a
+// valid feed, as they're often outdated or wrong.
+func (f *fetcher) move(ctx context.Context, l *log.Entry, df dueFeed, cache httpCache, doc *feed.Feed) {
+	target, redirected := movedTo(df.link, cache, doc)
+	if target != "" && isPageKind(df.kind) {
+		target = movedPageLink(target, df.link)
+		if target == df.link {
+			target = ""
+		}
+	}
+	count, err := trackMove(f.db, df.id, target)
+	if err != nil {
+		l.WithError(err).Error("tracking feed move")
+		return
+	}
+	if target == "" || count < f.moveAfter {
+		return
+	}
+	l = l.WithField("moved_to", target)
+	if !redirected {
+		parse, err := f.parser(df)
+		if err == nil {
+			_, _, err = f.download(ctx, target, httpCache{}, parse)
+		}
+		if err != nil {
+			l.WithError(err).Warn("new feed URL stated by feed is invalid")
+			return
+		}
+	}
+	err = moveFeed(f.db, df.id, target)
+	if err != nil {
+		l.WithError(err).Error("moving feed")
+		return
+	}
+	l.Info("feed moved")
+}
+
+// backoff records a failed fetch and schedules the next attempt with
+// exponential backoff. The feed is disabled after too many failures.
+func (f *fetcher) backoff(l *log.Entry, id int64, cache httpCache, fetchErr error, now time.Time) {
+	failures, disabled, err := failFeed(f.db, id, cache.status, fetchErr.Error(), f.maxFailures, now)
+	if err != nil {
+		l.WithError(err).Error("recording feed failure")
+		return
+	}
+	l = l.WithField("failures", failures)
+	if disabled {
+		l.Warn("feed disabled after too many failures")
+		return
+	}
+	next := f.sched.backoff(now, failures, cache.retryAfter)
+	err = setNextFetch(f.db, id, next)
+	if err != nil {
+		l.WithError(err).Error("scheduling feed")
+		return
+	}
+	l.WithField("next_fetch", next).Debug("feed scheduled after failure")
+}
+
+// parser returns the function that parses documents of the feed's kind.
+func (f *fetcher) parser(df dueFeed) (parseFunc, error) {
+	switch df.kind {
+	case kindFeed:
+		return feed.Parse, nil
+	case kindScrape:
+		c, err := findScrapeConfig(f.db, df.id)
+		if err != nil {
+			return nil, err
+		}
+		return c.Parser(), nil
+	case kindMonitor:
+		return monitorParser(f.db, df.id, time.Now().UTC())
+	case kindJSON:
+		c, err := findJSONConfig(f.db, df.id)
+		if err != nil {
+			return nil, err
+		}
+		return c.Parser(), nil
+	}
+	return nil, fmt.Errorf("unknown feed kind %q", df.kind)
+}
+
+// download and parse a feed using a conditional GET request based on the
+// validators of the previous response.
+//
+// The returned feed is nil if it was not modified or an error occurred. The
+// returned cache is the state of the new response, if there was any.
+func (f *fetcher) download(ctx context.Context, link string, prev httpCache, parse parseFunc) (*feed.Feed, httpCache, error) {
+	var cache httpCache
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, cache, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	// the fragment only tells feeds of the same page apart, see pageFeedLink
+	req.URL.Fragment = ""
+	client := *f.client
+	permanent := true
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		// remember the target of permanent redirects up to the first
+		// temporary one
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			if permanent {
+				cache.movedTo = req.URL.String()
+			}
+		default:
+			permanent = false
+		}
+		return nil
+	}
+	if prev.etag != "" {
+		req.Header.Set("If-None-Match", prev.etag)
+	}
+	if prev.lastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cache, err
+	}
+	defer resp.Body.Close()
+	cache.status = resp.StatusCode
+	cache.maxAge = parseMaxAge(resp.Header.Get("Cache-Control"))
+	cache.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cache, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, cache, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	cache.etag = resp.Header.Get("ETag")
+	cache.lastModified = resp.Header.Get("Last-Modified")
+	cache.hub, cache.self = parseLinkHeader(resp.Header["Link"], resp.Request.URL)
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, cache, err
+	}
+	if len(body) > maxFeedSize {
+		return nil, cache, fmt.Errorf("document exceeds %d bytes", maxFeedSize)
+	}
+	doc, err := parse(bytes.NewReader(body), resp.Header.Get("Content-Type"), resp.Request.URL)
+	return doc, cache, err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title><link>http://example.com/</link>
+<item><title>%s</title><guid>http://example.com/1</guid></item>
+</channel></rss>`
+
+// fetchFeed fetches a feed once regardless of its schedule.
+func fetchFeed(t *testing.T, f *fetcher, id int64) {
+	t.Helper()
+	feeds, err := f.selectDue(time.Now().Add(time.Hour * 24 * 365))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, df := range feeds {
+		if df.id == id {
+			f.fetchOne(context.Background(), df)
+			return
+		}
+	}
+	t.Fatalf("feed %d is not due", id)
+}
+
+// itemState returns the title and last update of the only item of a feed.
+func itemState(t *testing.T, db *sql.DB, feedID int64) (string, time.Time) {
+	t.Helper()
+	var title string
+	var updated time.Time
+	err := db.QueryRow(`SELECT title, last_update FROM feed_item WHERE feed_id = ?`, feedID).Scan(&title, &updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return title, updated
+}
+
+func validators(t *testing.T, db *sql.DB, feedID int64) (string, string) {
+	t.Helper()
+	var etag, lastModified string
+	err := db.QueryRow(
+		`SELECT COALESCE(etag, ''), COALESCE(last_modified, '') FROM feed WHERE id = ?`,
+		feedID,
+	).Scan(&etag, &lastModified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return etag, lastModified
+}
+
+func TestConditionalGet(t *testing.T) {
+	db := testDB(t)
+	type response struct {
+		status       int
+		etag         string
+		lastModified string
+		title        string
+	}
+	var (
+		wantINM, wantIMS string // expected request headers
+		resp             response
+		requests         int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.Header.Get("If-None-Match"); got != wantINM {
+			t.Errorf("request %d: If-None-Match %q, want %q", requests, got, wantINM)
+		}
+		if got := r.Header.Get("If-Modified-Since"); got != wantIMS {
+			t.Errorf("request %d: If-Modified-Since %q, want %q", requests, got, wantIMS)
+		}
+		if resp.etag != "" {
+			w.Header().Set("ETag", resp.etag)
+		}
+		if resp.lastModified != "" {
+			w.Header().Set("Last-Modified", resp.lastModified)
+		}
+		w.WriteHeader(resp.status)
+		if resp.status == http.StatusOK {
+			fmt.Fprintf(w, testRSS, resp.title)
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(db)
+	f.client = srv.Client()
+	feedID := subscribeTestFeed(t, db, srv.URL+"/feed.xml")
+
+	// first fetch without validators
+	resp = response{http.StatusOK, `"v1"`, "Mon, 02 Jan 2006 15:04:05 GMT", "first"}
+	fetchFeed(t, f, feedID)
+	etag, lastModified := validators(t, db, feedID)
+	if etag != `"v1"` || lastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Fatalf("stored validators %q %q after 200", etag, lastModified)
+	}
+	title, updated := itemState(t, db, feedID)
+	if title != "first" {
+		t.Fatalf("item title %q after 200", title)
+	}
+
+	// not modified: items and validators are kept
+	wantINM, wantIMS = `"v1"`, "Mon, 02 Jan 2006 15:04:05 GMT"
+	resp = response{status: http.StatusNotModified}
+	fetchFeed(t, f, feedID)
+	if gotTitle, gotUpdated := itemState(t, db, feedID); gotTitle != title || !gotUpdated.Equal(updated) {
+		t.Errorf("item changed by 304: %q %v, was %q %v", gotTitle, gotUpdated, title, updated)
+	}
+	if e, lm := validators(t, db, feedID); e != etag || lm != lastModified {
+		t.Errorf("validators changed by 304: %q %q", e, lm)
+	}
+	var status int
+	var errorCount int
+	err := db.QueryRow(`SELECT http_status, error_count FROM feed WHERE id = ?`, feedID).Scan(&status, &errorCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusNotModified || errorCount != 0 {
+		t.Errorf("304 stored as status %d with %d errors", status, errorCount)
+	}
+
+	// modified: validators are replaced, a missing one is cleared
+	resp = response{status: http.StatusOK, etag: `"v2"`, title: "second"}
+	fetchFeed(t, f, feedID)
+	if e, lm := validators(t, db, feedID); e != `"v2"` || lm != "" {
+		t.Errorf("stored validators %q %q after second 200", e, lm)
+	}
+	if title, _ := itemState(t, db, feedID); title != "second" {
+		t.Errorf("item title %q after second 200", title)
+	}
+
+	wantINM, wantIMS = `"v2"`, ""
+	resp = response{status: http.StatusNotModified}
+	fetchFeed(t, f, feedID)
+	if requests != 4 {
+		t.Errorf("%d requests, want 4", requests)
+	}
+}
+
+// subscribeTestFeed subscribes a new user to a feed and returns the feed id.
+func subscribeTestFeed(t *testing.T, db *sql.DB, link string) int64 {
+	t.Helper()
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = subscribe(db, userID, link, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	err = db.QueryRow(`SELECT id FROM feed WHERE feed_link = ?`, link).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/feed"
+)
+
+const (
+	// hubDefaultLease is granted if subscribers request no lease.
+	hubDefaultLease = 10 * 24 * time.Hour
+	// hubMinLease and hubMaxLease bound the lease requested by subscribers.
+	hubMinLease = time.Hour
+	hubMaxLease = 30 * 24 * time.Hour
+	// maxSecretLength is the maximum length of hub.secret allowed by WebSub.
+	maxSecretLength = 200
+	// hubMaxPending limits the verifications of intent running at once.
+	hubMaxPending = 10
+)
+
+// hub is a minimal WebSub hub for the tag feeds served by rssd. Subscribers
+// are sent the items that are new since their last notification.
+//
+// See https://www.w3.org/TR/websub/#hub
+type hub struct {
+	db      *sql.DB
+	client  *http.Client
+	wg      sync.WaitGroup // pending verifications of intent
+	pending chan struct{}  // semaphore of running verifications
+}
+
+func newHub(db *sql.DB, client *http.Client) *hub {
+	return &hub{
+		db:      db,
+		client:  client,
+		pending: make(chan struct{}, hubMaxPending),
+	}
+}
+
+// hubRequest is a subscription request of a subscriber.
+type hubRequest struct {
+	userID   int64
+	mode     string
+	topic    string
+	tag      string
+	callback string
+	secret   string
+	lease    time.Duration
+}
+
+// handleHub accepts subscription requests for tag feeds. The intent of the
+// subscriber is verified in the background. Requests are turned away while
+// hubMaxPending verifications are running.
+func handleHub(h *hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseHubRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case h.pending <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "too many pending verifications", http.StatusServiceUnavailable)
+			return
+		}
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.verify(req)
+			<-h.pending
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func parseHubRequest(r *http.Request) (hubRequest, error) {
+	req := hubRequest{
+		userID:   userID(r),
+		mode:     r.PostFormValue("hub.mode"),
+		topic:    r.PostFormValue("hub.topic"),
+		callback: r.PostFormValue("hub.callback"),
+		secret:   r.PostFormValue("hub.secret"),
+		lease:    hubDefaultLease,
+	}
+	if req.mode != "subscribe" && req.mode != "unsubscribe" {
+		return req, fmt.Errorf("unsupported hub.mode %q", req.mode)
+	}
+	if !feed.IsHTTP(req.callback) {
+		return req, fmt.Errorf("hub.callback must be a http or https URL")
+	}
+	if _, err := url.Parse(req.callback); err != nil {
+		return req, fmt.Errorf("invalid hub.callback: %v", err)
+	}
+	var ok bool
+	req.tag, ok = topicTag(publicURL(r), req.topic)
+	if !ok {
+		return req, fmt.Errorf("hub.topic %q is not a feed of this hub", req.topic)
+	}
+	if len(req.secret) > maxSecretLength {
+		return req, fmt.Errorf("hub.secret must be less than %d bytes", maxSecretLength)
+	}
+	if s, err := strconv.Atoi(r.PostFormValue("hub.lease_seconds")); err == nil {
+		req.lease = time.Duration(s) * time.Second
+		if req.lease < hubMinLease {
+			req.lease = hubMinLease
+		}
+		if req.lease > hubMaxLease {
+			req.lease = hubMaxLease
+		}
+	}
+	return req, nil
+}
+
+// topicTag returns the tag of a tag feed URL served from base.
+func topicTag(base *url.URL, topic string) (string, bool) {
+	prefix := base.String() + "tags/"
+	if !strings.HasPrefix(topic, prefix) || !strings.HasSuffix(topic, "/atom") {
+		return "", false
+	}
+	name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(topic, prefix), "/atom"))
+	if err != nil || name == "" {
+		return "", false
+	}
+	// only the canonical URL, as served in the self link of the feed
+	if base.String()+strings.TrimPrefix(tagFeedPath(name), "/") != topic {
+		return "", false
+	}
+	return name, true
+}
+
+// verify asks the subscriber to confirm a request by echoing a challenge and
+// stores or removes the subscription if it does.
+func (h *hub) verify(req hubRequest) {
+	l := log.WithField("mode", req.mode).
+		WithField("topic", req.topic).
+		WithField("callback", req.callback)
+	challenge, err := newSecret()
+	if err != nil {
+		l.WithError(err).Error("creating WebSub challenge")
+		return
+	}
+	u, _ := url.Parse(req.callback)
+	q := u.Query()
+	q.Set("hub.mode", req.mode)
+	q.Set("hub.topic", req.topic)
+	q.Set("hub.challenge", challenge)
+	if req.mode == "subscribe" {
+		q.Set("hub.lease_seconds", strconv.Itoa(int(req.lease.Seconds())))
+	}
+	u.RawQuery = q.Encode()
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		l.WithError(err).Warn("verifying WebSub intent")
+		return
+	}
+	httpReq.Header.Set("User-Agent", userAgent)
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		l.WithError(err).Warn("verifying WebSub intent")
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(len(challenge))+1))
+	resp.Body.Close()
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 || string(body) != challenge {
+		l.WithField("status", resp.StatusCode).Info("WebSub intent not confirmed")
+		return
+	}
+	now := time.Now().UTC()
+	if req.mode == "unsubscribe" {
+		_, err = h.db.Exec(`DELETE FROM hub_subscription WHERE topic = ? AND callback = ?`, req.topic, req.callback)
+	} else {
+		_, err = h.db.Exec(`
+INSERT INTO hub_subscription (user_id, tag, topic, callback, secret, expires, last_item_id)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, (SELECT COALESCE(MAX(id), 0) FROM feed_item))
+    ON CONFLICT (topic, callback) DO UPDATE
+   SET secret = excluded.secret,
+       expires = excluded.expires`,
+			req.userID,
+			req.tag,
+			req.topic,
+			req.callback,
+			nullString(req.secret),
+			now.Add(req.lease),
+		)
+	}
+	if err != nil {
+		l.WithError(err).Error("storing WebSub hub subscription")
+		return
+	}
+	l.Info("WebSub hub subscription verified")
+}
+
+// wait blocks until pending verifications are done.
+func (h *hub) wait() {
+	h.wg.Wait()
+}
+
+// hubSubscription is a verified subscription to a tag feed.
+type hubSubscription struct {
+	id         int64
+	userID     int64
+	tag        string
+	topic      string
+	callback   string
+	secret     string
+	lastItemID int64
+}
+
+// notify removes expired subscriptions and sends new items of tag feeds to
+// their subscribers. Failed deliveries are retried on the next call.
+func (h *hub) notify(ctx context.Context, now time.Time) {
+	_, err := h.db.Exec(`DELETE FROM hub_subscription WHERE expires <= ?`, now)
+	if err != nil {
+		log.WithError(err).Error("deleting expired WebSub hub subscriptions")
+		return
+	}
+	subs, err := h.subscriptions()
+	if err != nil {
+		log.WithError(err).Error("selecting WebSub hub subscriptions")
+		return
+	}
+	for _, s := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		h.notifySubscriber(ctx, s)
+	}
+}
+
+// notifySubscriber sends the new items of a tag feed to a subscriber in
+// batches of at most tagFeedLimit items, oldest first, until all items are
+// delivered or a delivery fails.
+func (h *hub) notifySubscriber(ctx context.Context, s hubSubscription) {
+	l := log.WithField("topic", s.topic).WithField("callback", s.callback)
+	for ctx.Err() == nil {
+		items, err := tagItemsAfter(h.db, s.userID, s.tag, s.lastItemID)
+		if err != nil {
+			l.WithError(err).Error("selecting new items of tag feed")
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+		gone, err := h.deliver(ctx, s, items)
+		if gone {
+			_, err = h.db.Exec(`DELETE FROM hub_subscription WHERE id = ?`, s.id)
+			if err != nil {
+				l.WithError(err).Error("deleting WebSub hub subscription")
+			}
+			l.Info("WebSub subscriber is gone")
+			return
+		}
+		if err != nil {
+			l.WithError(err).Warn("delivering WebSub notification")
+			return
+		}
+		s.lastItemID = items[len(items)-1].ID
+		_, err = h.db.Exec(`UPDATE hub_subscription SET last_item_id = ? WHERE id = ?`, s.lastItemID, s.id)
+		if err != nil {
+			l.WithError(err).Error("updating WebSub hub subscription")
+			return
+		}
+		l.WithField("items", len(items)).Debug("delivered WebSub notification")
+	}
+}
+
+func (h *hub) subscriptions() ([]hubSubscription, error) {
+	rows, err := h.db.Query(`
+SELECT id, user_id, tag, topic, callback, COALESCE(secret, ''), last_item_id
+  FROM hub_subscription
+ ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []hubSubscription
+	for rows.Next() {
+		var s hubSubscription
+		err = rows.Scan(&s.id, &s.userID, &s.tag, &s.topic, &s.callback, &s.secret, &s.lastItemID)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// deliver posts the new items as Atom feed to the callback of a subscriber,
+// signed with its secret. gone is true if the subscriber asked to stop.
+func (h *hub) deliver(ctx context.Context, s hubSubscription, items []publishedItem) (gone bool, err error) {
+	base, err := url.Parse(s.topic[:strings.LastIndex(s.topic, "tags/")])
+	if err != nil {
+		return false, err
+	}
+	hubURL := base.ResolveReference(&url.URL{Path: "hub"}).String()
+	buf := &bytes.Buffer{}
+	err = writeAtom(buf, base, "Tag: "+s.tag, s.topic, hubURL, items)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.callback, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/atom+xml; charset=utf-8")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Add("Link", "<"+hubURL+`>; rel="hub"`)
+	req.Header.Add("Link", "<"+s.topic+`>; rel="self"`)
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(buf.Bytes())
+		req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return true, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return false, nil
+}
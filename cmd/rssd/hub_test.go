@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHubNotifyDeliversAllItems(t *testing.T) {
+	db := testDB(t)
+	published := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var items []string
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<rss version="2.0"><channel><title>News</title>%s</channel></rss>`, strings.Join(items, ""))
+	}))
+	defer publisher.Close()
+	addItem := func(title string, date time.Time) {
+		items = append(items, fmt.Sprintf(
+			`<item><title>%[1]s</title><guid>%[1]s</guid><pubDate>%s</pubDate></item>`,
+			title,
+			date.Format(time.RFC1123Z),
+		))
+	}
+	var batches [][]string
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var doc atomFeed
+		if err := xml.NewDecoder(r.Body).Decode(&doc); err != nil {
+			t.Error(err)
+		}
+		var titles []string
+		for _, e := range doc.Entries {
+			titles = append(titles, e.Title)
+		}
+		batches = append(batches, titles)
+	}))
+	defer subscriber.Close()
+
+	feedID := subscribeTestFeed(t, db, publisher.URL)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setTags(db, userID, feedID, []string{"news"}); err != nil {
+		t.Fatal(err)
+	}
+	topic := "http://rssd.example/tags/news/atom"
+	_, err = db.Exec(`
+INSERT INTO hub_subscription (user_id, tag, topic, callback, expires, last_item_id)
+VALUES (?, 'news', ?, ?, ?, 0)`, userID, topic, subscriber.URL, published.AddDate(100, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFetcher(db)
+	f.client = publisher.Client()
+	h := newHub(db, subscriber.Client())
+	delivered := func() map[string]int {
+		seen := make(map[string]int)
+		for _, b := range batches {
+			if len(b) > tagFeedLimit {
+				t.Errorf("%d items in one notification, want at most %d", len(b), tagFeedLimit)
+			}
+			for _, title := range b {
+				seen[title]++
+			}
+		}
+		return seen
+	}
+
+	// more new items than fit into one notification
+	n := tagFeedLimit + 10
+	for i := 0; i < n; i++ {
+		addItem(fmt.Sprintf("item %d", i), published.Add(time.Duration(i)*time.Hour))
+	}
+	fetchFeed(t, f, feedID)
+	h.notify(context.Background(), published)
+	seen := delivered()
+	if len(seen) != n || len(batches) != 2 {
+		t.Errorf("%d of %d items delivered in %d notifications", len(seen), n, len(batches))
+	}
+	for title, count := range seen {
+		if count != 1 {
+			t.Errorf("%q delivered %d times", title, count)
+		}
+	}
+
+	// an item published before the items delivered already
+	batches = nil
+	addItem("late", published.Add(-time.Hour))
+	fetchFeed(t, f, feedID)
+	h.notify(context.Background(), published)
+	if got := fmt.Sprint(batches); got != "[[late]]" {
+		t.Errorf("delivered %s after late item, want [[late]]", got)
+	}
+	h.notify(context.Background(), published)
+	if got := fmt.Sprint(batches); got != "[[late]]" {
+		t.Errorf("delivered %s without new items, want [[late]]", got)
+	}
+}
+
+func TestHubLimitsPendingVerifications(t *testing.T) {
+	db := testDB(t)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.NotFound(w, r)
+	}))
+	defer subscriber.Close()
+	h := newHub(db, subscriber.Client())
+	post := func() int {
+		form := url.Values{
+			"hub.mode":     {"subscribe"},
+			"hub.topic":    {"http://rssd.example/tags/news/atom"},
+			"hub.callback": {subscriber.URL},
+		}
+		r := httptest.NewRequest(http.MethodPost, "http://rssd.example/hub", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		withUser(userID)(handleHub(h)).ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < hubMaxPending; i++ {
+		if code := post(); code != http.StatusAccepted {
+			t.Fatalf("request %d: status %d, want %d", i, code, http.StatusAccepted)
+		}
+	}
+	if code := post(); code != http.StatusServiceUnavailable {
+		t.Errorf("status %d with %d pending verifications, want %d", code, hubMaxPending, http.StatusServiceUnavailable)
+	}
+	close(release)
+	h.wait()
+	if code := post(); code != http.StatusAccepted {
+		t.Errorf("status %d after verifications finished, want %d", code, http.StatusAccepted)
+	}
+	h.wait()
+}
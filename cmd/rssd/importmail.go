@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/message"
+)
+
+// mailImport counts the messages of an archive by outcome.
+type mailImport struct {
+	imported   int
+	duplicates int
+	malformed  int
+}
+
+// importMail implements the import-mail command: it files the messages of
+// mbox files and Maildir directories as newsletters of a user.
+func importMail(args []string) error {
+	fs := flag.NewFlagSet("import-mail", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of rssd import-mail:")
+		fmt.Fprintln(fs.Output(), "  rssd import-mail [flags] mbox|maildir...")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&dbFile, "db", dbFile, "sqlite3 db file")
+	fs.StringVar(&userEmail, "user", userEmail, "email of the user the newsletters are imported for")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	userID, err := ensureUser(db, userEmail)
+	if err != nil {
+		return err
+	}
+	for _, path := range fs.Args() {
+		l := log.WithField("archive", path)
+		res, err := importArchive(db, userID, path)
+		if err != nil {
+			return fmt.Errorf("importing %s: %v", path, err)
+		}
+		l.WithField("imported", res.imported).
+			WithField("duplicates", res.duplicates).
+			WithField("malformed", res.malformed).
+			Info("archive imported")
+	}
+	return nil
+}
+
+// importArchive imports a Maildir if path is a directory, otherwise an mbox
+// file.
+func importArchive(db *sql.DB, userID int64, path string) (mailImport, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return mailImport{}, err
+	}
+	if fi.IsDir() {
+		return importMaildir(db, userID, path)
+	}
+	return importMbox(db, userID, path)
+}
+
+func importMaildir(db *sql.DB, userID int64, dir string) (mailImport, error) {
+	var res mailImport
+	files, err := message.MaildirFiles(dir)
+	if err != nil {
+		return res, err
+	}
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return res, err
+		}
+		err = importMessage(db, userID, raw, &res, log.WithField("file", f))
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func importMbox(db *sql.DB, userID int64, path string) (mailImport, error) {
+	var res mailImport
+	f, err := os.Open(path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	mbox := message.NewMboxReader(f)
+	for n := 1; ; n++ {
+		raw, err := mbox.Next()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		err = importMessage(db, userID, raw, &res, log.WithField("archive", path).WithField("message", n))
+		if err != nil {
+			return res, err
+		}
+	}
+}
+
+// importMessage stores a raw message unless the user already has a
+// newsletter with the same Message-ID. Malformed messages are logged and
+// skipped.
+func importMessage(db *sql.DB, userID int64, raw []byte, res *mailImport, l *log.Entry) error {
+	msg, err := message.Parse(bytes.NewReader(raw))
+	if err != nil {
+		l.WithError(err).Warn("skipping malformed message")
+		res.malformed++
+		return nil
+	}
+	var exists bool
+	err = db.QueryRow(`
+SELECT EXISTS (
+    SELECT 1
+      FROM feed_item i
+      JOIN feed_mail m ON m.feed_id = i.feed_id
+     WHERE m.user_id = ? AND i.guid = ?
+)`, userID, msg.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		res.duplicates++
+		return nil
+	}
+	err = storeMail(db, userID, msg, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	res.imported++
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportArchive(t *testing.T) {
+	db := testDB(t)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mbox := filepath.Join(dir, "news.mbox")
+	sep := "From news@example.com Mon Jan  1 00:00:00 2018\r\n"
+	data := sep + testMail + "\r\n" + sep + "Subject: no sender\r\n\r\n"
+	if err = ioutil.WriteFile(mbox, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	maildir := filepath.Join(dir, "Maildir")
+	if err = os.MkdirAll(filepath.Join(maildir, "cur"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(maildir, "cur", "1514764800.M1P1.host:2,S"), []byte(testMail), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := importArchive(db, userID, mbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (mailImport{imported: 1, malformed: 1}) {
+		t.Errorf("mbox import %+v", res)
+	}
+	// the same message in a Maildir
+	res, err = importArchive(db, userID, maildir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (mailImport{duplicates: 1}) {
+		t.Errorf("Maildir import %+v", res)
+	}
+	var url string
+	if err = db.QueryRow(`SELECT url FROM feed_item_enclosure`).Scan(&url); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "/attachments/") {
+		t.Errorf("attachment URL %q, want path on rssd", url)
+	}
+}
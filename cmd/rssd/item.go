@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+)
+
+// itemListLimit is the maximum amount of items shown on the index page.
+const itemListLimit = 100
+
+// itemView is a feed item prepared for rendering.
+type itemView struct {
+	ID          int64
+	FeedID      int64
+	FeedTitle   string
+	Title       string
+	Link        string
+	Published   time.Time
+	AuthorName  string
+	AuthorEmail string
+	Image       string
+	Episode     int64
+	Season      int64
+	Categories  []string
+	Enclosures  []enclosureView
+	// Body is the sanitized extracted article, content or summary, whichever
+	// is available first.
+	Body template.HTML
+}
+
+// enclosureView is a media file attached to an item.
+type enclosureView struct {
+	URL      string
+	Type     string
+	Length   int64
+	Title    string
+	Duration time.Duration
+}
+
+// IsAudio returns true if the enclosure can be played with an audio element.
+func (e enclosureView) IsAudio() bool {
+	return strings.HasPrefix(e.Type, "audio/")
+}
+
+// IsVideo returns true if the enclosure can be played with a video element.
+func (e enclosureView) IsVideo() bool {
+	return strings.HasPrefix(e.Type, "video/")
+}
+
+// IsImage returns true if the enclosure is an image.
+func (e enclosureView) IsImage() bool {
+	return strings.HasPrefix(e.Type, "image/")
+}
+
+// Size returns the length in human readable form.
+func (e enclosureView) Size() string {
+	const unit = 1024
+	if e.Length < unit {
+		return fmt.Sprintf("%d B", e.Length)
+	}
+	div, exp := int64(unit), 0
+	for n := e.Length / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(e.Length)/float64(div), "KMGTPE"[exp])
+}
+
+func handleIndex(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items, err := latestItems(db, itemListLimit)
+		if err != nil {
+			log.WithError(err).Error("selecting latest items")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		render(w, r, "index.html", items)
+	}
+}
+
+func handleItem(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		item, err := findItem(db, userID(r), id)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("feed_item_id", id).Error("selecting item")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		render(w, r, "item.html", item)
+	}
+}
+
+// latestItems returns the most recently published items of all feeds.
+func latestItems(db *sql.DB, limit int) ([]itemView, error) {
+	rows, err := db.Query(`
+SELECT i.id, i.feed_id, f.title, i.title, i.link, i.published
+  FROM feed_item i
+  JOIN feed f ON f.id = i.feed_id
+ ORDER BY i.published DESC
+ LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []itemView
+	for rows.Next() {
+		var item itemView
+		err = rows.Scan(&item.ID, &item.FeedID, &item.FeedTitle, &item.Title, &item.Link, &item.Published)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// findItem returns a single item including its categories and enclosures.
+// The extracted article is only used if the user enabled full content for
+// the feed.
+func findItem(db *sql.DB, userID, id int64) (*itemView, error) {
+	item := &itemView{ID: id}
+	var body string
+	err := db.QueryRow(`
+SELECT i.feed_id, f.title, i.title, i.link, i.published,
+       COALESCE(i.author_name, ''), COALESCE(i.author_email, ''),
+       COALESCE(i.image, ''), COALESCE(i.episode, 0), COALESCE(i.season, 0),
+       COALESCE(
+           CASE WHEN s.full_content THEN NULLIF(i.extracted_html, '') END,
+           NULLIF(i.content_html, ''),
+           i.summary_html,
+           ''
+       )
+  FROM feed_item i
+  JOIN feed f ON f.id = i.feed_id
+  LEFT JOIN subscription s ON s.feed_id = i.feed_id AND s.user_id = ?
+ WHERE i.id = ?`, userID, id).Scan(
+		&item.FeedID,
+		&item.FeedTitle,
+		&item.Title,
+		&item.Link,
+		&item.Published,
+		&item.AuthorName,
+		&item.AuthorEmail,
+		&item.Image,
+		&item.Episode,
+		&item.Season,
+		&body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// only sanitized HTML may be trusted
+	item.Body = template.HTML(body)
+	item.Categories, err = itemCategories(db, id)
+	if err != nil {
+		return nil, err
+	}
+	item.Enclosures, err = itemEnclosures(db, id)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func itemCategories(db *sql.DB, id int64) ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM feed_item_category WHERE feed_item_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []string
+	for rows.Next() {
+		var c string
+		if err = rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func itemEnclosures(db *sql.DB, id int64) ([]enclosureView, error) {
+	rows, err := db.Query(`
+SELECT url, COALESCE(type, ''), COALESCE(length, 0), COALESCE(title, ''), COALESCE(duration, 0)
+  FROM feed_item_enclosure
+ WHERE feed_item_id = ?
+ ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var enclosures []enclosureView
+	for rows.Next() {
+		var e enclosureView
+		var seconds int64
+		if err = rows.Scan(&e.URL, &e.Type, &e.Length, &e.Title, &seconds); err != nil {
+			return nil, err
+		}
+		e.Duration = time.Duration(seconds) * time.Second
+		enclosures = append(enclosures, e)
+	}
+	return enclosures, rows.Err()
+}
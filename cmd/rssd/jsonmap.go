@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/jsonmap"
+)
+
+// jsonPage is the kind of feeds mapped from JSON documents.
+var jsonPage = pageKind{
+	kind: kindJSON,
+	tmpl: "json.html",
+	name: "JSON feed",
+	form: func() pageForm { return &jsonView{} },
+}
+
+// jsonView is the data of the page for creating and editing JSON feeds.
+type jsonView struct {
+	pageView
+	Config  jsonmap.Config
+	Preview *feed.Feed
+}
+
+func (v *jsonView) read(get func(string) string) {
+	v.Config = jsonmap.Config{
+		Items: strings.TrimSpace(get("items")),
+		Title: strings.TrimSpace(get("title")),
+		Link:  strings.TrimSpace(get("link")),
+		ID:    strings.TrimSpace(get("id")),
+		Date:  strings.TrimSpace(get("date")),
+	}
+}
+
+func (v *jsonView) validate() error {
+	return v.Config.Validate()
+}
+
+func (v *jsonView) find(db *sql.DB, feedID int64) error {
+	var err error
+	v.Config, err = findJSONConfig(db, feedID)
+	return err
+}
+
+// preview downloads and maps the document.
+func (v *jsonView) preview(ctx context.Context, f *fetcher) error {
+	var err error
+	v.Preview, _, err = f.download(ctx, v.URL, httpCache{}, v.Config.Parser())
+	return err
+}
+
+func (v *jsonView) insert(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(`
+INSERT INTO feed_json (feed_id, items, title, link, guid, date)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		feedID,
+		v.Config.Items,
+		nullString(v.Config.Title),
+		nullString(v.Config.Link),
+		nullString(v.Config.ID),
+		nullString(v.Config.Date),
+	)
+	return err
+}
+
+func (v *jsonView) update(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(`
+UPDATE feed_json
+   SET items = ?,
+       title = ?,
+       link = ?,
+       guid = ?,
+       date = ?
+ WHERE feed_id = ?`,
+		v.Config.Items,
+		nullString(v.Config.Title),
+		nullString(v.Config.Link),
+		nullString(v.Config.ID),
+		nullString(v.Config.Date),
+		feedID,
+	)
+	return err
+}
+
+// findJSONConfig returns the paths of a JSON feed.
+func findJSONConfig(db *sql.DB, feedID int64) (jsonmap.Config, error) {
+	var c jsonmap.Config
+	err := db.QueryRow(`
+SELECT items, COALESCE(title, ''), COALESCE(link, ''), COALESCE(guid, ''), COALESCE(date, '')
+  FROM feed_json
+ WHERE feed_id = ?`, feedID).Scan(&c.Items, &c.Title, &c.Link, &c.ID, &c.Date)
+	return c, err
+}
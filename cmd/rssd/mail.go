@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/message"
+	"github.com/nochso/rss/smtpd"
+)
+
+// mailReceiver files mail sent to generated addresses as items of one feed
+// per user and sender.
+type mailReceiver struct {
+	db     *sql.DB
+	domain string
+}
+
+// newSMTPServer returns a server receiving mail for the generated addresses
+// of all users.
+func newSMTPServer(db *sql.DB) *smtpd.Server {
+	m := &mailReceiver{db: db, domain: smtpDomain}
+	return &smtpd.Server{
+		Addr:    smtpAddr,
+		Domain:  smtpDomain,
+		MaxSize: smtpMaxSize,
+		Accept: func(rcpt string) error {
+			_, err := m.recipient(rcpt)
+			return err
+		},
+		Deliver: m.deliver,
+	}
+}
+
+// recipient returns the user a generated address belongs to.
+func (m *mailReceiver) recipient(addr string) (int64, error) {
+	i := strings.LastIndexByte(addr, '@')
+	if i < 0 || !strings.EqualFold(addr[i+1:], m.domain) {
+		return 0, &smtpd.Error{Code: 550, Message: "5.1.2 relaying denied"}
+	}
+	var userID int64
+	err := m.db.QueryRow(`SELECT user_id FROM mail_address WHERE local = ?`, strings.ToLower(addr[:i])).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, &smtpd.Error{Code: 550, Message: "5.1.1 unknown recipient"}
+	}
+	return userID, err
+}
+
+func (m *mailReceiver) deliver(from string, to []string, data []byte) error {
+	l := log.WithField("mail_from", from)
+	msg, err := message.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		l.WithError(err).Info("rejecting malformed mail")
+		return &smtpd.Error{Code: 554, Message: "5.6.0 malformed message: " + err.Error()}
+	}
+	l = l.WithField("sender", msg.From.Address).WithField("message_id", msg.ID)
+	seen := make(map[int64]bool)
+	for _, rcpt := range to {
+		userID, err := m.recipient(rcpt)
+		if err != nil {
+			return err
+		}
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		err = storeMail(m.db, userID, msg, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	l.Debug("mail stored")
+	return nil
+}
+
+// storeMail stores a message as item of the feed of its sender, creating
+// the feed and subscribing the user to it if necessary. Messages are
+// identified by their Message-ID, so storing a message again updates it.
+func storeMail(db *sql.DB, userID int64, msg *message.Message, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storeMailTx(tx, userID, msg, now)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func storeMailTx(tx *sql.Tx, userID int64, msg *message.Message, now time.Time) error {
+	feedID, err := mailFeedTx(tx, userID, msg, now)
+	if err != nil {
+		return err
+	}
+	item := mailItem(msg)
+	if item.Published.IsZero() {
+		item.Published = now
+	}
+	err = storeItemTx(tx, feedID, "", item, now)
+	if err != nil {
+		return err
+	}
+	for _, p := range msg.Parts {
+		_, err = tx.Exec(
+			`INSERT OR IGNORE INTO mail_attachment (hash, type, data) VALUES (?, ?, ?)`,
+			contentHash(p.Data),
+			p.ContentType,
+			p.Data,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mailFeedTx returns the feed of the sender of msg for a user.
+func mailFeedTx(tx *sql.Tx, userID int64, msg *message.Message, now time.Time) (int64, error) {
+	sender := msg.From.Address
+	title := msg.From.Name
+	if title == "" {
+		title = sender
+	}
+	var feedID int64
+	err := tx.QueryRow(`SELECT feed_id FROM feed_mail WHERE user_id = ? AND sender = ?`, userID, sender).Scan(&feedID)
+	switch {
+	case err == sql.ErrNoRows:
+		link := &url.URL{Scheme: "mailto", Opaque: sender, RawQuery: "user=" + strconv.FormatInt(userID, 10)}
+		res, err := tx.Exec(
+			`INSERT INTO feed (title, feed_link, kind) VALUES (?, ?, ?)`,
+			title,
+			link.String(),
+			kindMail,
+		)
+		if err != nil {
+			return 0, err
+		}
+		feedID, err = res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO feed_mail (feed_id, user_id, sender) VALUES (?, ?, ?)`, feedID, userID, sender)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT OR IGNORE INTO subscription (user_id, feed_id) VALUES (?, ?)`, userID, feedID)
+		if err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	}
+	_, err = tx.Exec(`
+UPDATE feed
+   SET title = ?1,
+       link = ?2,
+       last_update = ?3,
+       last_success = ?3
+ WHERE id = ?4`, title, "mailto:"+sender, now, feedID)
+	return feedID, err
+}
+
+// mailItem converts a message to an item. Attachments become enclosures and
+// inline images referenced by cid: URLs are linked to their attachment.
+//
+// Attachments are linked by their path on rssd, so the links stay valid if
+// the public URL of rssd changes. Paths are resolved when serving feeds.
+func mailItem(msg *message.Message) *feed.Item {
+	item := &feed.Item{
+		GUID:      msg.ID,
+		Title:     msg.Subject,
+		Published: msg.Date,
+		Author:    feed.Person{Name: msg.From.Name, Email: msg.From.Address},
+	}
+	if item.Title == "" {
+		item.Title = "(no subject)"
+	}
+	content := msg.HTML
+	if content == "" {
+		content = textToHTML(msg.Text)
+	}
+	for _, p := range msg.Parts {
+		u := attachmentPath(p)
+		if p.ContentID != "" {
+			for _, cid := range []string{p.ContentID, url.PathEscape(p.ContentID)} {
+				content = strings.Replace(content, "cid:"+cid, u, -1)
+			}
+		}
+		item.Enclosures = append(item.Enclosures, &feed.Enclosure{
+			URL:    u,
+			Type:   p.ContentType,
+			Length: int64(len(p.Data)),
+			Title:  p.Filename,
+		})
+	}
+	item.Content = content
+	return item
+}
+
+// attachmentPath returns the path an attachment is served at, relative to
+// the root of rssd.
+func attachmentPath(p message.Part) string {
+	name := p.Filename
+	if name == "" {
+		name = "attachment"
+	}
+	return "/attachments/" + contentHash(p.Data) + "/" + url.PathEscape(name)
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// textToHTML converts a plain text body to paragraphs.
+func textToHTML(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	var b strings.Builder
+	for _, p := range strings.Split(text, "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.Replace(html.EscapeString(p), "\n", "<br>", -1))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// inlineTypes are attachment types that may be displayed by browsers. Any
+// other type is downloaded, as it could run scripts on the origin of rssd.
+var inlineTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"audio/mpeg": true,
+	"audio/ogg":  true,
+	"video/mp4":  true,
+	"video/webm": true,
+}
+
+// handleAttachment serves an attachment of a mail by the hash of its
+// content.
+func handleAttachment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		var typ string
+		var data []byte
+		err := db.QueryRow(`SELECT type, data FROM mail_attachment WHERE hash = ?`, hash).Scan(&typ, &data)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("hash", hash).Error("selecting attachment")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		if inlineTypes[typ] {
+			w.Header().Set("Content-Type", typ)
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+		w.Write(data)
+	}
+}
+
+// mailView is the data of the page listing the mail addresses of a user.
+type mailView struct {
+	Enabled   bool // false if the SMTP server is not running
+	Addresses []mailAddress
+}
+
+type mailAddress struct {
+	ID      int64
+	Address string
+}
+
+func handleMail(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mailView{Enabled: smtpAddr != ""}
+		var err error
+		v.Addresses, err = mailAddresses(db, userID(r))
+		if err != nil {
+			log.WithError(err).Error("selecting mail addresses")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		render(w, r, "mail.html", v)
+	}
+}
+
+// handleMailCreate generates a new address for the user.
+func handleMailCreate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		local, err := newLocalPart()
+		if err == nil {
+			_, err = db.Exec(`INSERT INTO mail_address (user_id, local) VALUES (?, ?)`, userID(r), local)
+		}
+		if err != nil {
+			log.WithError(err).Error("creating mail address")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/mail", http.StatusSeeOther)
+	}
+}
+
+// handleMailDelete deletes an address of the user. Mail to it is rejected
+// from now on, while received items are kept.
+func handleMailDelete(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, err = db.Exec(`DELETE FROM mail_address WHERE id = ? AND user_id = ?`, id, userID(r))
+		if err != nil {
+			log.WithError(err).WithField("id", id).Error("deleting mail address")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/mail", http.StatusSeeOther)
+	}
+}
+
+func mailAddresses(db *sql.DB, userID int64) ([]mailAddress, error) {
+	rows, err := db.Query(`SELECT id, local FROM mail_address WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var addrs []mailAddress
+	for rows.Next() {
+		var a mailAddress
+		var local string
+		err = rows.Scan(&a.ID, &local)
+		if err != nil {
+			return nil, err
+		}
+		a.Address = local + "@" + smtpDomain
+		addrs = append(addrs, a)
+	}
+	return addrs, rows.Err()
+}
+
+// newLocalPart returns a random local part that is hard to guess, so
+// addresses can't be found by spammers.
+func newLocalPart() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
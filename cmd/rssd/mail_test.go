@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nochso/rss/message"
+	"github.com/nochso/rss/smtpd"
+)
+
+const testMail = "From: News <news@example.com>\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"Subject: Issue 1\r\n" +
+	"Content-Type: multipart/related; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p><img src=\"cid:logo@example.com\"></p>\r\n" +
+	"--b\r\n" +
+	"Content-Type: image/png; name=logo.png\r\n" +
+	"Content-ID: <logo@example.com>\r\n" +
+	"\r\n" +
+	"PNG\r\n" +
+	"--b--\r\n"
+
+func TestMailAttachmentPaths(t *testing.T) {
+	db := testDB(t)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := message.Parse(strings.NewReader(testMail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storeMail(db, userID, msg, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	path := "/attachments/" + contentHash([]byte("PNG")) + "/logo.png"
+	var content, enclosure string
+	err = db.QueryRow(`
+SELECT i.content_html, e.url
+  FROM feed_item i
+  JOIN feed_item_enclosure e ON e.feed_item_id = i.id`).Scan(&content, &enclosure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<img src="` + path + `"/>`; !strings.Contains(content, want) || enclosure != path {
+		t.Fatalf("content %q and enclosure %q, want links to %s", content, enclosure, path)
+	}
+
+	// feeds served by rssd link to its public URL
+	var feedID int64
+	if err = db.QueryRow(`SELECT feed_id FROM feed_mail`).Scan(&feedID); err != nil {
+		t.Fatal(err)
+	}
+	if err = setTags(db, userID, feedID, []string{"news"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := tagItems(db, userID, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	base, _ := url.Parse("https://rss.example.com/")
+	if err = writeAtom(buf, base, "Tag: news", base.String()+"tags/news/atom", base.String()+"hub", items); err != nil {
+		t.Fatal(err)
+	}
+	if want := `src=&#34;https://rss.example.com` + path + `&#34;`; !strings.Contains(buf.String(), want) {
+		t.Errorf("Atom feed lacks %s:\n%s", want, buf)
+	}
+}
+
+const testNewsletter = "From: Weekly News <News@Example.com>\r\n" +
+	"To: %s\r\n" +
+	"Message-ID: <issue-2@example.com>\r\n" +
+	"Date: Mon, 01 Jan 2018 10:00:00 +0000\r\n" +
+	"Subject: Issue 2\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<h1 onclick=\"alert(1)\">News</h1><script>alert(2)</script>\r\n" +
+	"<p><img src=\"cid:logo@example.com\"></p>\r\n" +
+	"--inner\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <logo@example.com>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"UE5H\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"issue 2.pdf\"\r\n" +
+	"\r\n" +
+	"%%PDF\r\n" +
+	"--outer--\r\n"
+
+func TestSMTPServer(t *testing.T) {
+	db := testDB(t)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := newLocalPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO mail_address (user_id, local) VALUES (?, ?)`, userID, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newSMTPServer(db)
+	done := make(chan error)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+	defer func() {
+		srv.Shutdown(context.Background())
+		if err := <-done; err != smtpd.ErrServerClosed {
+			t.Errorf("Serve returned %v", err)
+		}
+	}()
+	addr := l.Addr().String()
+	rcpt := strings.ToUpper(local) + "@" + smtpDomain
+
+	// rejected recipients
+	for _, to := range []string{"unknown@" + smtpDomain, local + "@example.com"} {
+		err = smtp.SendMail(addr, nil, "news@example.com", []string{to}, []byte("Subject: x\r\n\r\nx\r\n"))
+		if e, ok := err.(*textproto.Error); !ok || e.Code != 550 {
+			t.Errorf("sending to %s: %v, want 550", to, err)
+		}
+	}
+
+	err = smtp.SendMail(addr, nil, "bounces@example.com", []string{rcpt}, []byte(fmt.Sprintf(testNewsletter, rcpt)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feedID int64
+	var title, link string
+	err = db.QueryRow(`
+SELECT f.id, f.title, f.link
+  FROM feed f
+  JOIN feed_mail m ON m.feed_id = f.id
+  JOIN subscription s ON s.feed_id = f.id
+ WHERE m.user_id = ? AND m.sender = 'news@example.com' AND s.user_id = ?`, userID, userID).Scan(&feedID, &title, &link)
+	if err != nil {
+		t.Fatalf("sender feed: %v", err)
+	}
+	if title != "Weekly News" || link != "mailto:news@example.com" {
+		t.Errorf("sender feed %q %q", title, link)
+	}
+	var itemID int64
+	var guid, content string
+	var published time.Time
+	err = db.QueryRow(`
+SELECT id, guid, title, published, content_html
+  FROM feed_item
+ WHERE feed_id = ?`, feedID).Scan(&itemID, &guid, &title, &published, &content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guid != "issue-2@example.com" || title != "Issue 2" || !published.Equal(time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("item %q %q %v", guid, title, published)
+	}
+	logo := "/attachments/" + contentHash([]byte("PNG")) + "/attachment"
+	pdf := "/attachments/" + contentHash([]byte("%PDF")) + "/issue%202.pdf"
+	if want := `<h1>News</h1>` + "\n" + `<p><img src="` + logo + `"/></p>`; content != want {
+		t.Errorf("content %q, want %q", content, want)
+	}
+	rows, err := db.Query(`SELECT url, type, length, title FROM feed_item_enclosure WHERE feed_item_id = ? ORDER BY id`, itemID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var enclosures []string
+	for rows.Next() {
+		var u, typ, title string
+		var length int64
+		if err = rows.Scan(&u, &typ, &length, &title); err != nil {
+			t.Fatal(err)
+		}
+		enclosures = append(enclosures, fmt.Sprintf("%s %s %d %q", u, typ, length, title))
+	}
+	want := []string{
+		logo + ` image/png 3 ""`,
+		pdf + ` application/pdf 4 "issue 2.pdf"`,
+	}
+	if fmt.Sprint(enclosures) != fmt.Sprint(want) {
+		t.Errorf("enclosures %q, want %q", enclosures, want)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,20 +12,73 @@ import (
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/logfmt"
+	"github.com/nochso/rss/smtpd"
 )
 
 var (
 	dbFile    = "rss.sqlite3"
+	userEmail = "rssd@localhost"
 	httpAddr  = ":8080"
 	httpGrace = time.Second * 10
+	baseURL   = ""
+
+	smtpAddr    = ""
+	smtpDomain  = "localhost"
+	smtpMaxSize = int64(10 << 20)
+
+	fetchInterval = time.Hour
+	fetchMin      = time.Minute * 15
+	fetchMax      = time.Hour * 24
+	fetchTimeout  = time.Second * 30
+	fetchWorkers  = 4
+
+	fetchMaxFailures = 10
+	fetchMoveAfter   = 3
 )
 
+// commands are run instead of the server when their name is the first
+// argument.
+var commands = map[string]func(args []string) error{
+	"import-mail": importMail,
+	"import-opml": importOPML,
+	"export-opml": exportOPML,
+}
+
 func main() {
 	log.SetLevel(log.DebugLevel)
 	log.SetHandler(logfmt.Default)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			err := cmd(os.Args[2:])
+			if err != nil {
+				log.WithError(err).Fatal(os.Args[1] + " failed")
+			}
+			return
+		}
+	}
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage of rssd:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rssd [flags]")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rssd import-mail [flags] mbox|maildir...")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rssd import-opml [flags] file...")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rssd export-opml [flags]")
+		flag.PrintDefaults()
+	}
 	flag.StringVar(&dbFile, "db", dbFile, "sqlite3 db file")
+	flag.StringVar(&userEmail, "user", userEmail, "email of the user the web interface acts as")
 	flag.StringVar(&httpAddr, "http", httpAddr, "HTTP listening address")
+	flag.StringVar(&baseURL, "base-url", baseURL, "public URL of rssd used as WebSub callback, push subscriptions are disabled if empty")
 	flag.DurationVar(&httpGrace, "grace", httpGrace, "HTTP shutdown grace period for existing connections")
+	flag.StringVar(&smtpAddr, "smtp", smtpAddr, "SMTP listening address for receiving newsletters, disabled if empty")
+	flag.StringVar(&smtpDomain, "smtp-domain", smtpDomain, "domain of the generated newsletter addresses")
+	flag.Int64Var(&smtpMaxSize, "smtp-max-size", smtpMaxSize, "maximum size of a received mail in bytes")
+	flag.DurationVar(&fetchInterval, "fetch-interval", fetchInterval, "time between updates of a feed when its posting frequency is unknown")
+	flag.DurationVar(&fetchMin, "fetch-min", fetchMin, "minimum time between updates of a feed")
+	flag.DurationVar(&fetchMax, "fetch-max", fetchMax, "maximum time between updates of a feed")
+	flag.DurationVar(&fetchTimeout, "fetch-timeout", fetchTimeout, "timeout for downloading a single feed")
+	flag.IntVar(&fetchWorkers, "fetch-workers", fetchWorkers, "amount of feeds downloaded in parallel")
+	flag.IntVar(&fetchMaxFailures, "fetch-max-failures", fetchMaxFailures, "consecutive failures after which a feed is disabled, 0 to never disable")
+	flag.IntVar(&fetchMoveAfter, "fetch-move-after", fetchMoveAfter, "consecutive fetches a permanent redirect or new feed URL must be seen before the feed URL is updated")
 	flag.Parse()
 
 	err := run()
@@ -46,33 +101,91 @@ func run() error {
 	}
 	defer closeDB(db)
 
+	userID, err := ensureUser(db, userEmail)
+	if err != nil {
+		return err
+	}
+
+	n, err := resanitize(db)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.WithField("items", n).Info("sanitized items with outdated rules")
+	}
+
+	var smtp *smtpd.Server
+	var smtpListener net.Listener
+	if smtpAddr != "" {
+		smtp = newSMTPServer(db)
+		smtpListener, err = net.Listen("tcp", smtpAddr)
+		if err != nil {
+			return err
+		}
+	}
+
+	f := newFetcher(db)
+	if baseURL != "" {
+		f.websub, err = newSubscriber(db, f.client, baseURL)
+		if err != nil {
+			if smtpListener != nil {
+				smtpListener.Close()
+			}
+			return err
+		}
+	}
+	f.hub = newHub(db, f.client)
+	f.start()
+
 	srv := &http.Server{
 		Addr:    httpAddr,
-		Handler: newRouter(),
+		Handler: newRouter(db, userID, f),
 	}
 
-	idleConnsClosed := make(chan struct{})
-	go waitForShutdown(srv, idleConnsClosed)
-
-	log.WithField("http_addr", httpAddr).Info("HTTP server starting to listen")
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		// Error starting or closing listener
-		return err
+	smtpErr := make(chan error, 1)
+	if smtp != nil {
+		log.WithField("smtp_addr", smtpAddr).Info("SMTP server listening")
+		go func() {
+			smtpErr <- smtp.Serve(smtpListener)
+		}()
 	}
-	<-idleConnsClosed
-	return nil
-}
+	httpErr := make(chan error, 1)
+	go func() {
+		log.WithField("http_addr", httpAddr).Info("HTTP server starting to listen")
+		httpErr <- srv.ListenAndServe()
+	}()
 
-func waitForShutdown(srv *http.Server, idleConnsClosed chan struct{}) {
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt)
-	<-sigint
-	log.WithField("timeout", httpGrace).Info("interrupt signal received. shutting down HTTP server with timeout for existing connections.")
+	select {
+	case <-sigint:
+		log.WithField("timeout", httpGrace).Info("interrupt signal received. shutting down HTTP server with timeout for existing connections.")
+	case err = <-httpErr:
+		// error starting or closing the listener
+		err = fmt.Errorf("HTTP server: %v", err)
+	case err = <-smtpErr:
+		err = fmt.Errorf("SMTP server: %v", err)
+	}
+	shutdown(srv, smtp, f)
+	return err
+}
+
+// shutdown stops the servers and the fetcher. Servers that failed already
+// are shut down as well, which is harmless.
+func shutdown(srv *http.Server, smtp *smtpd.Server, f *fetcher) {
 	ctx, cancel := context.WithTimeout(context.Background(), httpGrace)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(ctx); err != nil && err != http.ErrServerClosed {
 		// Error from closing listeners, or context timeout:
 		log.WithError(err).Error("HTTP server Shutdown")
 	}
-	close(idleConnsClosed)
+	if smtp != nil {
+		if err := smtp.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("SMTP server Shutdown")
+		}
+	}
+	// wait for in-flight feed updates and verifications before the db is
+	// closed
+	f.stop()
+	f.hub.wait()
 }
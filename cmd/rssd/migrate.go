@@ -186,5 +186,242 @@ CREATE TABLE user (
                   PRIMARY KEY,
     email VARCHAR NOT NULL
                   UNIQUE
+);`),
+	MigrateString(`
+ALTER TABLE feed_item ADD COLUMN summary VARCHAR;
+ALTER TABLE feed_item ADD COLUMN content VARCHAR;
+ALTER TABLE feed_item ADD COLUMN author_name VARCHAR;
+ALTER TABLE feed_item ADD COLUMN author_email VARCHAR;
+
+CREATE TABLE feed_item_category (
+    id           INTEGER PRIMARY KEY
+                         NOT NULL,
+    feed_item_id INTEGER REFERENCES feed_item (id) ON DELETE CASCADE
+                         NOT NULL,
+    name         VARCHAR NOT NULL,
+    UNIQUE (
+        feed_item_id,
+        name
+    )
+);`),
+	MigrateString(`
+ALTER TABLE feed_item ADD COLUMN image VARCHAR;
+ALTER TABLE feed_item ADD COLUMN episode INTEGER;
+ALTER TABLE feed_item ADD COLUMN season INTEGER;
+
+CREATE TABLE feed_item_enclosure (
+    id           INTEGER PRIMARY KEY
+                         NOT NULL,
+    feed_item_id INTEGER REFERENCES feed_item (id) ON DELETE CASCADE
+                         NOT NULL,
+    url          VARCHAR NOT NULL,
+    type         VARCHAR,
+    length       INTEGER,
+    title        VARCHAR,
+    -- playback duration in seconds
+    duration     INTEGER,
+    UNIQUE (
+        feed_item_id,
+        url
+    )
+);`),
+	MigrateString(`
+ALTER TABLE feed ADD COLUMN etag VARCHAR;
+ALTER TABLE feed ADD COLUMN last_modified VARCHAR;
+ALTER TABLE feed ADD COLUMN http_status INTEGER;`),
+	MigrateString(`
+ALTER TABLE feed ADD COLUMN next_fetch DATETIME;
+-- minimum seconds between fetches as requested by the feed
+ALTER TABLE feed ADD COLUMN ttl INTEGER;
+-- comma separated hours (0-23 UTC) and weekdays (0-6 starting on Sunday)
+ALTER TABLE feed ADD COLUMN skip_hours VARCHAR;
+ALTER TABLE feed ADD COLUMN skip_days VARCHAR;
+
+CREATE INDEX idx_feed__next_fetch ON feed (
+    next_fetch
+);
+
+CREATE INDEX idx_feed_item__feed_id_published ON feed_item (
+    feed_id,
+    published
+);`),
+	MigrateString(`
+ALTER TABLE feed ADD COLUMN error_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feed ADD COLUMN last_error VARCHAR;
+ALTER TABLE feed ADD COLUMN last_success DATETIME;
+ALTER TABLE feed ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;`),
+	MigrateString(`
+-- new URL of the feed and the amount of consecutive fetches it was seen
+ALTER TABLE feed ADD COLUMN moved_to VARCHAR;
+ALTER TABLE feed ADD COLUMN moved_count INTEGER NOT NULL DEFAULT 0;`),
+	// subscription.id was not declared as INTEGER and therefore no alias of
+	// rowid, requiring explicit ids on insert. Both tables are recreated as
+	// dropping subscription alone would cascade to subscription_tag.
+	MigrateString(`
+CREATE TEMP TABLE subscription_old AS SELECT * FROM subscription;
+CREATE TEMP TABLE subscription_tag_old AS SELECT * FROM subscription_tag;
+DROP TABLE subscription_tag;
+DROP TABLE subscription;
+
+CREATE TABLE subscription (
+    id      INTEGER PRIMARY KEY
+                    NOT NULL,
+    -- Delete subscriptions when deleting user
+    user_id INTEGER REFERENCES user (id) ON DELETE CASCADE
+                    NOT NULL,
+    -- Forbid deleting feeds that have a subscription
+    feed_id INTEGER REFERENCES feed (id) ON DELETE RESTRICT
+                    NOT NULL,
+    UNIQUE (
+        user_id,
+        feed_id
+    )
+);
+
+CREATE TABLE subscription_tag (
+    id              INTEGER PRIMARY KEY
+                            NOT NULL,
+    -- Delete subscription tags when deleting subscription
+    subscription_id INTEGER REFERENCES subscription (id) ON DELETE CASCADE
+                            NOT NULL,
+    -- Forbid deleting tags used by a subscription
+    tag_id          INTEGER REFERENCES tag (id) ON DELETE RESTRICT
+                            NOT NULL,
+    UNIQUE (
+        subscription_id,
+        tag_id
+    )
+);
+
+INSERT INTO subscription SELECT id, user_id, feed_id FROM subscription_old;
+INSERT INTO subscription_tag SELECT id, subscription_id, tag_id FROM subscription_tag_old;
+DROP TABLE subscription_old;
+DROP TABLE subscription_tag_old;`),
+	MigrateString(`
+-- newline separated problems of the last document that had to be repaired
+ALTER TABLE feed ADD COLUMN parse_warnings VARCHAR;`),
+	MigrateString(`
+-- summary and content made safe for rendering
+ALTER TABLE feed_item ADD COLUMN summary_html VARCHAR;
+ALTER TABLE feed_item ADD COLUMN content_html VARCHAR;
+-- sanitize.Version used for the *_html columns, zero if never sanitized
+ALTER TABLE feed_item ADD COLUMN sanitizer_version INTEGER NOT NULL DEFAULT 0;`),
+	MigrateString(`
+-- download the article of each item
+ALTER TABLE subscription ADD COLUMN full_content BOOLEAN NOT NULL DEFAULT 0;
+-- main article of the item link and its sanitized version
+ALTER TABLE feed_item ADD COLUMN extracted VARCHAR;
+ALTER TABLE feed_item ADD COLUMN extracted_html VARCHAR;
+-- time of the extraction, NULL if not attempted yet
+ALTER TABLE feed_item ADD COLUMN extracted_at DATETIME;
+ALTER TABLE feed_item ADD COLUMN extract_error VARCHAR;`),
+	MigrateString(`
+-- CSS selectors for extracting articles of a host
+CREATE TABLE extract_rule (
+    id        INTEGER PRIMARY KEY
+                      NOT NULL,
+    host      VARCHAR NOT NULL
+                      UNIQUE,
+    content   VARCHAR NOT NULL,
+    remove    VARCHAR,
+    next_page VARCHAR
+);`),
+	MigrateString(`
+-- how the document at feed_link is turned into items, see kindFeed
+ALTER TABLE feed ADD COLUMN kind VARCHAR NOT NULL DEFAULT 'feed';
+
+-- CSS selectors of feeds of kind scrape
+CREATE TABLE feed_scrape (
+    feed_id INTEGER PRIMARY KEY
+                    NOT NULL
+                    REFERENCES feed (id) ON DELETE CASCADE,
+    item    VARCHAR NOT NULL,
+    title   VARCHAR,
+    link    VARCHAR,
+    date    VARCHAR
+);`),
+	MigrateString(`
+-- feeds of kind monitor, NULL selector for the whole page
+CREATE TABLE feed_monitor (
+    feed_id  INTEGER PRIMARY KEY
+                     NOT NULL
+                     REFERENCES feed (id) ON DELETE CASCADE,
+    selector VARCHAR
+);`),
+	MigrateString(`
+-- paths of feeds of kind json, guid is the path of the item ID
+CREATE TABLE feed_json (
+    feed_id INTEGER PRIMARY KEY
+                    NOT NULL
+                    REFERENCES feed (id) ON DELETE CASCADE,
+    items   VARCHAR NOT NULL,
+    title   VARCHAR,
+    link    VARCHAR,
+    guid    VARCHAR,
+    date    VARCHAR
+);`),
+	MigrateString(`
+-- WebSub subscriptions of feeds, lease_expires is NULL until verified
+CREATE TABLE websub (
+    feed_id       INTEGER  PRIMARY KEY
+                           NOT NULL
+                           REFERENCES feed (id) ON DELETE CASCADE,
+    hub           VARCHAR  NOT NULL,
+    topic         VARCHAR  NOT NULL,
+    secret        VARCHAR  NOT NULL,
+    requested_at  DATETIME NOT NULL,
+    lease_expires DATETIME,
+    renew_at      DATETIME NOT NULL
+);`),
+	MigrateString(`
+-- subscribers of the built-in WebSub hub to tag feeds, last_item_id is the
+-- newest item delivered
+CREATE TABLE hub_subscription (
+    id           INTEGER  PRIMARY KEY
+                          NOT NULL,
+    user_id      INTEGER  REFERENCES user (id) ON DELETE CASCADE
+                          NOT NULL,
+    tag          VARCHAR  NOT NULL,
+    topic        VARCHAR  NOT NULL,
+    callback     VARCHAR  NOT NULL,
+    secret       VARCHAR,
+    expires      DATETIME NOT NULL,
+    last_item_id INTEGER  NOT NULL,
+    UNIQUE (
+        topic,
+        callback
+    )
+);`),
+	MigrateString(`
+-- generated addresses receiving newsletters for a user
+CREATE TABLE mail_address (
+    id      INTEGER PRIMARY KEY
+                    NOT NULL,
+    user_id INTEGER REFERENCES user (id) ON DELETE CASCADE
+                    NOT NULL,
+    local   VARCHAR NOT NULL
+                    UNIQUE
+);
+
+-- feeds of kind mail, one per user and sender
+CREATE TABLE feed_mail (
+    feed_id INTEGER PRIMARY KEY
+                    NOT NULL
+                    REFERENCES feed (id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES user (id) ON DELETE CASCADE
+                    NOT NULL,
+    sender  VARCHAR NOT NULL,
+    UNIQUE (
+        user_id,
+        sender
+    )
+);
+
+-- attachments of mails by SHA-256 of their content
+CREATE TABLE mail_attachment (
+    hash VARCHAR PRIMARY KEY
+                 NOT NULL,
+    type VARCHAR NOT NULL,
+    data BLOB    NOT NULL
 );`),
 }
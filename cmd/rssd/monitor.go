@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/monitor"
+)
+
+// monitorContext is the amount of unchanged lines shown around changes.
+const monitorContext = 3
+
+// monitorParser returns a parser for a monitored page. It returns a feed
+// with a single item if the text of the page changed since the last item,
+// or no items otherwise.
+//
+// The text of the page is stored as summary of each item, so the latest item
+// is the snapshot new versions are compared to. Monitoring starts over if
+// its summary is NULL, see monitorView.update.
+func monitorParser(db *sql.DB, feedID int64, now time.Time) (parseFunc, error) {
+	selector, err := findMonitorSelector(db, feedID)
+	if err != nil {
+		return nil, err
+	}
+	var prev *string
+	err = db.QueryRow(`
+SELECT summary
+  FROM feed_item
+ WHERE feed_id = ?
+ ORDER BY published DESC, id DESC
+ LIMIT 1`, feedID).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return func(r io.Reader, contentType string, base *url.URL) (*feed.Feed, error) {
+		snap, err := monitor.Take(r, contentType, selector)
+		if err != nil {
+			return nil, err
+		}
+		doc := &feed.Feed{Title: snap.Title, Link: base.String()}
+		hash := textHash(snap.Text)
+		if prev != nil && textHash(*prev) == hash {
+			return doc, nil
+		}
+		item := &feed.Item{
+			GUID:        fmt.Sprintf("sha256:%s@%d", hash, now.Unix()),
+			Link:        base.String(),
+			Published:   now,
+			Description: snap.Text,
+		}
+		if prev == nil {
+			item.Title = "Monitoring started"
+			item.Content = "<pre>" + html.EscapeString(snap.Text) + "</pre>"
+		} else {
+			diff := monitor.Diff(*prev, snap.Text)
+			inserted, deleted := monitor.Count(diff)
+			item.Title = fmt.Sprintf("Changed: %d lines added, %d removed", inserted, deleted)
+			item.Content = monitor.HTML(diff, monitorContext)
+		}
+		doc.Items = []*feed.Item{item}
+		return doc, nil
+	}, nil
+}
+
+func textHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// monitorPage is the kind of feeds reporting changes of web pages.
+var monitorPage = pageKind{
+	kind: kindMonitor,
+	tmpl: "monitor.html",
+	name: "page monitor",
+	form: func() pageForm { return &monitorView{} },
+}
+
+// monitorView is the data of the page for creating and editing monitors.
+type monitorView struct {
+	pageView
+	Selector string
+	Preview  *monitor.Snapshot
+}
+
+func (v *monitorView) read(get func(string) string) {
+	v.Selector = strings.TrimSpace(get("selector"))
+}
+
+func (v *monitorView) validate() error {
+	if v.Selector != "" {
+		if _, err := cascadia.ParseGroup(v.Selector); err != nil {
+			return fmt.Errorf("invalid selector: %v", err)
+		}
+	}
+	return nil
+}
+
+func (v *monitorView) find(db *sql.DB, feedID int64) error {
+	var err error
+	v.Selector, err = findMonitorSelector(db, feedID)
+	return err
+}
+
+// preview downloads the page and takes its snapshot.
+func (v *monitorView) preview(ctx context.Context, f *fetcher) error {
+	_, _, err := f.download(ctx, v.URL, httpCache{}, func(r io.Reader, contentType string, base *url.URL) (*feed.Feed, error) {
+		var err error
+		v.Preview, err = monitor.Take(r, contentType, v.Selector)
+		return &feed.Feed{}, err
+	})
+	return err
+}
+
+func (v *monitorView) insert(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO feed_monitor (feed_id, selector) VALUES (?, ?)`,
+		feedID,
+		nullString(v.Selector),
+	)
+	return err
+}
+
+// update changes the selector of a page monitor and clears its snapshots,
+// as the text selected by the new selector must not be compared to that of
+// the old one. Monitoring starts over with the next fetch.
+func (v *monitorView) update(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(
+		`UPDATE feed_monitor SET selector = ? WHERE feed_id = ?`,
+		nullString(v.Selector),
+		feedID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE feed_item SET summary = NULL WHERE feed_id = ?`, feedID)
+	return err
+}
+
+func findMonitorSelector(db *sql.DB, feedID int64) (string, error) {
+	var selector string
+	err := db.QueryRow(
+		`SELECT COALESCE(selector, '') FROM feed_monitor WHERE feed_id = ?`,
+		feedID,
+	).Scan(&selector)
+	return selector, err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// itemTitles returns the titles of the items of a feed, oldest first.
+func itemTitles(t *testing.T, db *sql.DB, feedID int64) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT title FROM feed_item WHERE feed_id = ? ORDER BY id`, feedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var titles []string
+	for rows.Next() {
+		var title string
+		if err = rows.Scan(&title); err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+func TestUpdateMonitorSelector(t *testing.T) {
+	db := testDB(t)
+	price := "10"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("ETag", `"`+price+`"`)
+		fmt.Fprintf(w, `<html><body><p id="price">%s EUR</p><p id="stock">In stock</p></body></html>`, price)
+	}))
+	defer srv.Close()
+	page := srv.URL + "/product"
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second monitor of the same page
+	for _, sel := range []string{"#stock", "#price"} {
+		err = createPageFeed(db, userID, kindMonitor, &monitorView{pageView: pageView{URL: page}, Selector: sel})
+		if err != nil {
+			t.Fatalf("creating monitor %s: %v", sel, err)
+		}
+	}
+	var feedID int64
+	err = db.QueryRow(`SELECT feed_id FROM feed_monitor WHERE selector = '#price'`).Scan(&feedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFetcher(db)
+	f.client = srv.Client()
+
+	fetchFeed(t, f, feedID)
+	price = "12"
+	fetchFeed(t, f, feedID)
+	got := itemTitles(t, db, feedID)
+	want := []string{"Monitoring started", "Changed: 1 lines added, 1 removed"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("items %q, want %q", got, want)
+	}
+
+	// the text of the new selector must not be compared to the old one
+	err = updatePageFeed(db, kindMonitor, &monitorView{pageView: pageView{FeedID: feedID, URL: page}, Selector: "#stock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var etag, lastModified sql.NullString
+	var nextFetch *string
+	err = db.QueryRow(`SELECT etag, last_modified, next_fetch FROM feed WHERE id = ?`, feedID).Scan(&etag, &lastModified, &nextFetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag.Valid || lastModified.Valid || nextFetch != nil {
+		t.Errorf("validators %v %v and next fetch %v kept after update", etag, lastModified, nextFetch)
+	}
+	fetchFeed(t, f, feedID)
+	got = itemTitles(t, db, feedID)
+	want = append(want, "Monitoring started")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("items %q after update, want %q", got, want)
+	}
+}
+
+func TestMonitorPreview(t *testing.T) {
+	db := testDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>Shop</title></head><body><p id="price">10 EUR</p><p>Other</p></body></html>`)
+	}))
+	defer srv.Close()
+	saved := templates
+	defer func() { templates = saved }()
+	templates = map[string]*template.Template{
+		"monitor.html": template.Must(template.New("monitor.html").Parse(
+			`{{.Error}}{{with .Preview}}{{.Title}}: {{.Text}}{{end}}`,
+		)),
+	}
+	f := newFetcher(db)
+	f.client = srv.Client()
+	q := url.Values{"preview": {"1"}, "url": {srv.URL}, "selector": {"#price"}}
+	w := httptest.NewRecorder()
+	handlePageForm(db, f, monitorPage)(w, httptest.NewRequest(http.MethodGet, "/monitor?"+q.Encode(), nil))
+	if got, want := w.Body.String(), "Shop: 10 EUR"; got != want {
+		t.Errorf("preview %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/feed"
+)
+
+// movedTo returns the URL a feed has moved to according to the last
+// response, or an empty string if it has not moved. redirected is true if the
+// URL is the target of permanent redirects.
+//
+// Permanent redirects are preferred over URLs stated by the document.
+func movedTo(link string, cache httpCache, doc *feed.Feed) (target string, redirected bool) {
+	if cache.movedTo != "" && cache.movedTo != link {
+		return cache.movedTo, true
+	}
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range []string{doc.NewFeedURL, doc.Self} {
+		if c != "" && c != link && feed.IsHTTP(c) {
+			return c, false
+		}
+	}
+	return "", false
+}
+
+// trackMove counts how many consecutive fetches agreed on the feed's new URL.
+// The count is reset if target is empty.
+func trackMove(db *sql.DB, id int64, target string) (int, error) {
+	if target == "" {
+		_, err := db.Exec(`UPDATE feed SET moved_to = NULL, moved_count = 0 WHERE id = ?`, id)
+		return 0, err
+	}
+	_, err := db.Exec(`
+UPDATE feed
+   SET moved_count = CASE
+                     WHEN moved_to = ?1 THEN moved_count + 1
+                     ELSE 1
+                     END,
+       moved_to = ?1
+ WHERE id = ?2`, target, id)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = db.QueryRow(`SELECT moved_count FROM feed WHERE id = ?`, id).Scan(&count)
+	return count, err
+}
+
+// moveFeed changes the URL of a feed within a single transaction.
+func moveFeed(db *sql.DB, id int64, target string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = moveFeedTx(tx, id, target)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveFeedTx changes the URL of a feed. If another feed already has the new
+// URL, the feed is merged into it: subscriptions, tags, items and their
+// read and bookmark state are moved before the old feed is deleted.
+func moveFeedTx(tx *sql.Tx, id int64, target string) error {
+	var existingID int64
+	err := tx.QueryRow(`SELECT id FROM feed WHERE feed_link = ?`, target).Scan(&existingID)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(`
+UPDATE feed
+   SET feed_link = ?,
+       moved_to = NULL,
+       moved_count = 0,
+       etag = NULL,
+       last_modified = NULL
+ WHERE id = ?`, target, id)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	log.WithField("feed_id", id).
+		WithField("into_feed_id", existingID).
+		Info("merging moved feed into existing feed")
+	return mergeFeedTx(tx, id, existingID)
+}
+
+// mergeFeedTx moves everything belonging to feed src over to feed dst and
+// deletes src.
+func mergeFeedTx(tx *sql.Tx, src, dst int64) error {
+	for _, stmt := range mergeFeedStmts {
+		_, err := tx.Exec(stmt, src, dst)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`DELETE FROM feed WHERE id = ?`, src)
+	return err
+}
+
+// mergeFeedStmts are executed by mergeFeedTx with ?1 being the old and ?2
+// the remaining feed.
+var mergeFeedStmts = []string{
+	// tags of users subscribed to both feeds
+	`
+INSERT OR IGNORE INTO subscription_tag (subscription_id, tag_id)
+SELECT d.id, st.tag_id
+  FROM subscription s
+  JOIN subscription d ON d.user_id = s.user_id AND d.feed_id = ?2
+  JOIN subscription_tag st ON st.subscription_id = s.id
+ WHERE s.feed_id = ?1`,
+	// subscriptions to both feeds are now duplicates
+	`
+DELETE FROM subscription
+ WHERE feed_id = ?1
+   AND user_id IN (SELECT user_id FROM subscription WHERE feed_id = ?2)`,
+	`
+UPDATE subscription SET feed_id = ?2 WHERE feed_id = ?1`,
+	// read and bookmark state of items contained in both feeds
+	`
+UPDATE OR IGNORE user_feed_item_read
+   SET feed_item_id = (
+       SELECT d.id
+         FROM feed_item s
+         JOIN feed_item d ON d.guid = s.guid AND d.feed_id = ?2
+        WHERE s.id = user_feed_item_read.feed_item_id
+       )
+ WHERE feed_item_id IN (
+       SELECT s.id
+         FROM feed_item s
+         JOIN feed_item d ON d.guid = s.guid AND d.feed_id = ?2
+        WHERE s.feed_id = ?1
+       )`,
+	`
+UPDATE OR IGNORE user_feed_item_bookmark
+   SET feed_item_id = (
+       SELECT d.id
+         FROM feed_item s
+         JOIN feed_item d ON d.guid = s.guid AND d.feed_id = ?2
+        WHERE s.id = user_feed_item_bookmark.feed_item_id
+       )
+ WHERE feed_item_id IN (
+       SELECT s.id
+         FROM feed_item s
+         JOIN feed_item d ON d.guid = s.guid AND d.feed_id = ?2
+        WHERE s.feed_id = ?1
+       )`,
+	// items only contained in the old feed, duplicates are deleted with it
+	`
+UPDATE OR IGNORE feed_item SET feed_id = ?2 WHERE feed_id = ?1`,
+}
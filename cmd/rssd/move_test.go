@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// moveTestState returns rows of a query as strings, e.g. "user guid".
+func moveTestState(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var state []string
+	for rows.Next() {
+		var a, b string
+		if err = rows.Scan(&a, &b); err != nil {
+			t.Fatal(err)
+		}
+		state = append(state, a+" "+b)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestMoveFeedMerge(t *testing.T) {
+	db := testDB(t)
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := map[string]int64{}
+	for _, email := range []string{"a@localhost", "b@localhost", "c@localhost"} {
+		id, err := ensureUser(db, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[email] = id
+	}
+	feeds := map[string]int64{}
+	subs := map[string]int64{}
+	for _, s := range []struct{ email, link string }{
+		{"a@localhost", "http://old.example.com/feed"},
+		{"a@localhost", "http://new.example.com/feed"},
+		{"b@localhost", "http://old.example.com/feed"},
+		{"c@localhost", "http://new.example.com/feed"},
+	} {
+		subID, err := subscribe(db, users[s.email], s.link, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[s.email+" "+s.link] = subID
+		var feedID int64
+		err = db.QueryRow(`SELECT id FROM feed WHERE feed_link = ?`, s.link).Scan(&feedID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		feeds[s.link] = feedID
+	}
+	oldID, newID := feeds["http://old.example.com/feed"], feeds["http://new.example.com/feed"]
+	items := map[string]int64{}
+	for _, it := range []struct {
+		feed int64
+		guid string
+	}{
+		{oldID, "1"}, {oldID, "2"}, {newID, "1"}, {newID, "3"},
+	} {
+		res, err := db.Exec(
+			`INSERT INTO feed_item (feed_id, guid, title, link, published, last_update) VALUES (?, ?, ?, '', ?, ?)`,
+			it.feed, it.guid, "item "+it.guid, now, now,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := "new"
+		if it.feed == oldID {
+			key = "old"
+		}
+		items[key+" "+it.guid], _ = res.LastInsertId()
+	}
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []struct{ email, item string }{
+		{"a@localhost", "old 1"},
+		{"a@localhost", "old 2"},
+		{"a@localhost", "new 1"},
+		{"b@localhost", "old 1"},
+	} {
+		exec(`INSERT INTO user_feed_item_read (user_id, feed_item_id) VALUES (?, ?)`, users[r.email], items[r.item])
+	}
+	for _, b := range []struct{ email, item string }{
+		{"a@localhost", "old 2"},
+		{"b@localhost", "old 1"},
+	} {
+		exec(`INSERT INTO user_feed_item_bookmark (user_id, feed_item_id) VALUES (?, ?)`, users[b.email], items[b.item])
+	}
+	for _, tag := range []struct{ sub, name string }{
+		{"a@localhost http://old.example.com/feed", "x"},
+		{"a@localhost http://old.example.com/feed", "y"},
+		{"a@localhost http://new.example.com/feed", "y"},
+		{"b@localhost http://old.example.com/feed", "z"},
+	} {
+		exec(`INSERT OR IGNORE INTO tag (name) VALUES (?)`, tag.name)
+		exec(`INSERT INTO subscription_tag (subscription_id, tag_id) SELECT ?, id FROM tag WHERE name = ?`, subs[tag.sub], tag.name)
+	}
+
+	if err := moveFeed(db, oldID, "http://new.example.com/feed"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"feeds", `SELECT id, feed_link FROM feed ORDER BY id`, []string{
+			"2 http://new.example.com/feed",
+		}},
+		{"items", `SELECT feed_id, guid FROM feed_item ORDER BY guid`, []string{
+			"2 1", "2 2", "2 3",
+		}},
+		{"subscriptions", `
+SELECT u.email, f.feed_link
+  FROM subscription s
+  JOIN user u ON u.id = s.user_id
+  JOIN feed f ON f.id = s.feed_id
+ ORDER BY u.email`, []string{
+			"a@localhost http://new.example.com/feed",
+			"b@localhost http://new.example.com/feed",
+			"c@localhost http://new.example.com/feed",
+		}},
+		{"tags", `
+SELECT u.email, t.name
+  FROM subscription_tag st
+  JOIN subscription s ON s.id = st.subscription_id
+  JOIN user u ON u.id = s.user_id
+  JOIN tag t ON t.id = st.tag_id
+ WHERE s.feed_id = 2
+ ORDER BY u.email, t.name`, []string{
+			"a@localhost x",
+			"a@localhost y",
+			"b@localhost z",
+		}},
+		{"read", `
+SELECT u.email, i.guid
+  FROM user_feed_item_read r
+  JOIN user u ON u.id = r.user_id
+  JOIN feed_item i ON i.id = r.feed_item_id
+ WHERE i.feed_id = 2
+ ORDER BY u.email, i.guid`, []string{
+			"a@localhost 1",
+			"a@localhost 2",
+			"b@localhost 1",
+		}},
+		{"bookmarks", `
+SELECT u.email, i.guid
+  FROM user_feed_item_bookmark b
+  JOIN user u ON u.id = b.user_id
+  JOIN feed_item i ON i.id = b.feed_item_id
+ WHERE i.feed_id = 2
+ ORDER BY u.email, i.guid`, []string{
+			"a@localhost 2",
+			"b@localhost 1",
+		}},
+		// state of the deleted feed's duplicate items is gone
+		{"orphans", `
+SELECT COUNT(*), 'read' FROM user_feed_item_read WHERE feed_item_id NOT IN (SELECT id FROM feed_item)
+ UNION ALL
+SELECT COUNT(*), 'bookmark' FROM user_feed_item_bookmark WHERE feed_item_id NOT IN (SELECT id FROM feed_item)`, []string{
+			"0 read",
+			"0 bookmark",
+		}},
+	}
+	for _, test := range tests {
+		if got := moveTestState(t, db, test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMoveFeed(t *testing.T) {
+	db := testDB(t)
+	id := subscribeTestFeed(t, db, "http://old.example.com/feed")
+	_, err := db.Exec(`UPDATE feed SET etag = 'x', last_modified = 'y', moved_to = 'http://new.example.com/feed', moved_count = 2 WHERE id = ?`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = moveFeed(db, id, "http://new.example.com/feed"); err != nil {
+		t.Fatal(err)
+	}
+	got := moveTestState(t, db, `
+SELECT feed_link, COALESCE(etag, '') || COALESCE(last_modified, '') || COALESCE(moved_to, '') || moved_count
+  FROM feed`)
+	if want := []string{"http://new.example.com/feed 0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/opml"
+)
+
+// maxOPMLSize limits the size of uploaded OPML files.
+const maxOPMLSize = 10 << 20
+
+// opmlTitle is the title of exported OPML documents.
+const opmlTitle = "rssd subscriptions"
+
+// handleOPMLExport serves the subscriptions of the user as OPML file.
+func handleOPMLExport(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := opmlSubscriptions(db, userID(r))
+		if err != nil {
+			log.WithError(err).Error("selecting subscriptions for OPML export")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="rssd.opml"`)
+		err = opml.Write(w, opmlTitle, subs, time.Now())
+		if err != nil {
+			log.WithError(err).Error("writing OPML")
+		}
+	}
+}
+
+// handleOPMLImport subscribes the user to the feeds of an uploaded OPML
+// file.
+func handleOPMLImport(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+		f, _, err := r.FormFile("opml")
+		if err != nil {
+			http.Error(w, "missing OPML file", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		subs, err := opml.Parse(f)
+		if err != nil {
+			http.Error(w, "invalid OPML: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := subscribeOPML(db, userID(r), subs)
+		if err != nil {
+			log.WithError(err).Error("importing OPML")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.WithField("subscriptions", n).Info("OPML imported")
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+// subscribeOPML subscribes the user to feeds and adds their tags to the
+// subscriptions. Existing tags are kept. Feeds without HTTP URL are skipped.
+// It returns the amount of imported subscriptions.
+func subscribeOPML(db *sql.DB, userID int64, subs []opml.Subscription) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	n, err := subscribeOPMLTx(tx, userID, subs)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func subscribeOPMLTx(tx *sql.Tx, userID int64, subs []opml.Subscription) (int, error) {
+	n := 0
+	for _, s := range subs {
+		if !feed.IsHTTP(s.FeedURL) {
+			log.WithField("feed_link", s.FeedURL).Info("skipping OPML outline without HTTP feed URL")
+			continue
+		}
+		subID, err := subscribeTx(tx, userID, s.FeedURL, s.Title)
+		if err != nil {
+			return 0, err
+		}
+		if feed.IsHTTP(s.SiteURL) {
+			// until the first update
+			_, err = tx.Exec(`UPDATE feed SET link = ? WHERE feed_link = ? AND link IS NULL`, s.SiteURL, s.FeedURL)
+			if err != nil {
+				return 0, err
+			}
+		}
+		for _, t := range s.Tags {
+			// tags are comma separated in the web interface
+			t = strings.Join(strings.Fields(strings.Replace(t, ",", " ", -1)), " ")
+			if t == "" {
+				continue
+			}
+			err = addTagTx(tx, subID, t)
+			if err != nil {
+				return 0, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// opmlSubscriptions returns the subscriptions of the user to RSS, Atom and
+// JSON feeds with their tags. Scraped, monitored, mapped and mail feeds are
+// left out as their configuration can not be expressed in OPML.
+func opmlSubscriptions(db *sql.DB, userID int64) ([]opml.Subscription, error) {
+	rows, err := db.Query(`
+SELECT f.id, f.title, f.feed_link, COALESCE(f.link, '')
+  FROM feed f
+  JOIN subscription s ON s.feed_id = f.id
+ WHERE s.user_id = ? AND f.kind = ?
+ ORDER BY f.title COLLATE NOCASE`, userID, kindFeed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags, err := subscriptionTags(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var subs []opml.Subscription
+	for rows.Next() {
+		var id int64
+		var s opml.Subscription
+		err = rows.Scan(&id, &s.Title, &s.FeedURL, &s.SiteURL)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags[id] {
+			s.Tags = append(s.Tags, t.Name)
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// importOPML implements the import-opml command.
+func importOPML(args []string) error {
+	fs := flag.NewFlagSet("import-opml", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of rssd import-opml:")
+		fmt.Fprintln(fs.Output(), "  rssd import-opml [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&dbFile, "db", dbFile, "sqlite3 db file")
+	fs.StringVar(&userEmail, "user", userEmail, "email of the user the subscriptions are imported for")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	userID, err := ensureUser(db, userEmail)
+	if err != nil {
+		return err
+	}
+	for _, path := range fs.Args() {
+		subs, err := readOPML(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		n, err := subscribeOPML(db, userID, subs)
+		if err != nil {
+			return err
+		}
+		log.WithField("file", path).WithField("subscriptions", n).Info("OPML imported")
+	}
+	return nil
+}
+
+func readOPML(path string) ([]opml.Subscription, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return opml.Parse(f)
+}
+
+// exportOPML implements the export-opml command.
+func exportOPML(args []string) error {
+	out := "-"
+	fs := flag.NewFlagSet("export-opml", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of rssd export-opml:")
+		fmt.Fprintln(fs.Output(), "  rssd export-opml [flags]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&dbFile, "db", dbFile, "sqlite3 db file")
+	fs.StringVar(&userEmail, "user", userEmail, "email of the user whose subscriptions are exported")
+	fs.StringVar(&out, "o", out, "output file, - for stdout")
+	fs.Parse(args)
+
+	db, err := openDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	userID, err := ensureUser(db, userEmail)
+	if err != nil {
+		return err
+	}
+	subs, err := opmlSubscriptions(db, userID)
+	if err != nil {
+		return err
+	}
+	var w io.WriteCloser = os.Stdout
+	if out != "-" {
+		w, err = os.Create(out)
+		if err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	err = opml.Write(bw, opmlTitle, subs, time.Now())
+	if err == nil {
+		err = bw.Flush()
+	}
+	if out != "-" {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.WithField("subscriptions", len(subs)).Info("OPML exported")
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/feed"
+)
+
+// pageKind describes a kind of feed that is created from a web page or
+// document by a form: scraped, monitored and JSON feeds. The forms of these
+// feeds are served by handlePageForm and handlePageSave.
+type pageKind struct {
+	kind string // see kindScrape
+	tmpl string // template of the form
+	name string // used in log messages, e.g. "scraped feed"
+	// form returns a new empty form
+	form func() pageForm
+}
+
+// pageForm is the form of a pageKind.
+type pageForm interface {
+	// page returns the fields shared by all forms.
+	page() *pageView
+	// read reads the form values of the configuration.
+	read(get func(string) string)
+	// validate returns an error if the configuration is invalid.
+	validate() error
+	// find reads the configuration of a feed from the db.
+	find(db *sql.DB, feedID int64) error
+	// preview downloads the page and stores the result in the form.
+	preview(ctx context.Context, f *fetcher) error
+	// insert stores the configuration of a new feed.
+	insert(tx *sql.Tx, feedID int64) error
+	// update changes the configuration of an existing feed.
+	update(tx *sql.Tx, feedID int64) error
+}
+
+// pageView is the part of the data of a pageForm that is shared by all kinds.
+type pageView struct {
+	FeedID int64 // zero for new feeds
+	URL    string
+	Error  string
+}
+
+func (v *pageView) page() *pageView {
+	return v
+}
+
+// handlePageForm shows the form of a new or existing feed of kind k. With
+// preview set, the page is downloaded and the result is shown.
+func handlePageForm(db *sql.DB, f *fetcher, k pageKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		form := k.form()
+		if id, err := strconv.ParseInt(q.Get("feed"), 10, 64); err == nil {
+			err = findPageFeed(db, k.kind, id, form)
+			if err == sql.ErrNoRows {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				log.WithError(err).WithField("feed_id", id).Error("selecting " + k.name)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+		if q.Get("preview") != "" {
+			form = k.form()
+			readPageForm(form, q.Get)
+			err := validatePageForm(form)
+			if err == nil {
+				err = form.preview(r.Context(), f)
+			}
+			if err != nil {
+				form.page().Error = err.Error()
+			}
+		}
+		render(w, r, k.tmpl, form)
+	}
+}
+
+// handlePageSave creates a feed of kind k and subscribes the user to it, or
+// updates the configuration of an existing one.
+func handlePageSave(db *sql.DB, k pageKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		form := k.form()
+		readPageForm(form, r.PostFormValue)
+		err := validatePageForm(form)
+		if err != nil {
+			form.page().Error = err.Error()
+			renderStatus(w, r, http.StatusBadRequest, k.tmpl, form)
+			return
+		}
+		if form.page().FeedID == 0 {
+			err = createPageFeed(db, userID(r), k.kind, form)
+		} else {
+			err = updatePageFeed(db, k.kind, form)
+		}
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("feed_link", form.page().URL).Error("saving " + k.name)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+func readPageForm(form pageForm, get func(string) string) {
+	v := form.page()
+	v.URL = strings.TrimSpace(get("url"))
+	v.FeedID, _ = strconv.ParseInt(get("feed_id"), 10, 64)
+	form.read(get)
+}
+
+func validatePageForm(form pageForm) error {
+	if !feed.IsHTTP(form.page().URL) {
+		return errors.New("URL must be a http or https URL")
+	}
+	return form.validate()
+}
+
+// findPageFeed fills form with the feed of the given kind and id.
+func findPageFeed(db *sql.DB, kind string, id int64, form pageForm) error {
+	v := form.page()
+	err := db.QueryRow(`SELECT feed_link FROM feed WHERE id = ? AND kind = ?`, id, kind).Scan(&v.URL)
+	if err != nil {
+		return err
+	}
+	v.FeedID = id
+	v.URL = pageURL(v.URL)
+	return form.find(db, id)
+}
+
+func createPageFeed(db *sql.DB, userID int64, kind string, form pageForm) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = createPageFeedTx(tx, userID, kind, form)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func createPageFeedTx(tx *sql.Tx, userID int64, kind string, form pageForm) error {
+	link, err := pageFeedLink(form.page().URL, kind)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO feed (title, feed_link, kind) VALUES ('', ?, ?)`, link, kind)
+	if err != nil {
+		return err
+	}
+	feedID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = form.insert(tx, feedID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO subscription (user_id, feed_id) VALUES (?, ?)`, userID, feedID)
+	return err
+}
+
+// updatePageFeed changes the configuration of a feed of the given kind.
+// sql.ErrNoRows is returned if there is no such feed.
+func updatePageFeed(db *sql.DB, kind string, form pageForm) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = updatePageFeedTx(tx, kind, form)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// updatePageFeedTx changes the configuration of a feed and schedules it
+// immediately. The validators are reset so the page is processed again even
+// if it did not change.
+func updatePageFeedTx(tx *sql.Tx, kind string, form pageForm) error {
+	id := form.page().FeedID
+	err := tx.QueryRow(`SELECT id FROM feed WHERE id = ? AND kind = ?`, id, kind).Scan(&id)
+	if err != nil {
+		return err
+	}
+	err = form.update(tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+UPDATE feed
+   SET etag = NULL,
+       last_modified = NULL,
+       next_fetch = NULL
+ WHERE id = ?`, id)
+	return err
+}
+
+// pageFeedLink returns a new feed_link for a feed of the given kind that is
+// created from a web page or document, i.e. a scraped, monitored or JSON
+// feed. As feed_link is unique, the feeds of the same page are told apart by
+// a random fragment, e.g. a scraped feed and a monitor of the same page or
+// the scrape configurations of two users. Fragments are never requested.
+func pageFeedLink(page, kind string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	u.Fragment = kind + "-" + hex.EncodeToString(b)
+	return u.String(), nil
+}
+
+// isPageKind returns true for the kinds of feeds created by pageFeedLink.
+func isPageKind(kind string) bool {
+	return kind == kindScrape || kind == kindMonitor || kind == kindJSON
+}
+
+// pageURL returns the URL of the page of a feed created by pageFeedLink.
+func pageURL(feedLink string) string {
+	u, err := url.Parse(feedLink)
+	if err != nil {
+		return feedLink
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// movedPageLink returns the feed_link of a page feed whose page moved to
+// target. The fragment of the old feed_link is kept.
+func movedPageLink(target, feedLink string) string {
+	t, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	l, err := url.Parse(feedLink)
+	if err != nil {
+		return target
+	}
+	t.Fragment = l.Fragment
+	return t.String()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPageFeedLink(t *testing.T) {
+	a, err := pageFeedLink("https://example.com/api?page=1", kindJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pageFeedLink("https://example.com/api?page=1", kindJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("feed links of the same page are equal: %q", a)
+	}
+	if !strings.HasPrefix(a, "https://example.com/api?page=1#json-") {
+		t.Errorf("feed link %q", a)
+	}
+	if got := pageURL(a); got != "https://example.com/api?page=1" {
+		t.Errorf("pageURL(%q) = %q", a, got)
+	}
+	if got, want := movedPageLink("https://example.org/v2/api", a), "https://example.org/v2/api#"+a[strings.Index(a, "#")+1:]; got != want {
+		t.Errorf("movedPageLink = %q, want %q", got, want)
+	}
+}
+
+func TestPageForms(t *testing.T) {
+	db := testDB(t)
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	saved := templates
+	defer func() { templates = saved }()
+	templates = map[string]*template.Template{
+		"json.html": template.Must(template.New("json.html").Parse(
+			`{{.FeedID}} {{.URL}} {{.Config.Items}} {{.Error}}{{with .Preview}}{{range .Items}}{{.Title}};{{end}}{{end}}`,
+		)),
+	}
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFetcher(db)
+	f.client = srv.Client()
+	form := handlePageForm(db, f, jsonPage)
+	save := handlePageSave(db, jsonPage)
+	api := srv.URL + "/api"
+	do := func(h http.HandlerFunc, method string, v url.Values) *httptest.ResponseRecorder {
+		var r *http.Request
+		if method == http.MethodGet {
+			r = httptest.NewRequest(method, "/json?"+v.Encode(), nil)
+		} else {
+			r = httptest.NewRequest(method, "/json", strings.NewReader(v.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		withUser(userID)(h).ServeHTTP(w, r)
+		return w
+	}
+
+	// invalid forms are shown again
+	w := do(save, http.MethodPost, url.Values{"url": {"ftp://example.com/"}, "items": {"posts"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "http or https") {
+		t.Errorf("invalid URL: %d %q", w.Code, w.Body.String())
+	}
+	w = do(save, http.MethodPost, url.Values{"url": {api}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("missing items path: %d %q", w.Code, w.Body.String())
+	}
+
+	// the same document mapped twice
+	for _, items := range []string{"posts", "data.posts"} {
+		w = do(save, http.MethodPost, url.Values{"url": {api}, "items": {items}, "title": {"name"}})
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("saving JSON feed %s: %d %q", items, w.Code, w.Body.String())
+		}
+	}
+	var id int64
+	err = db.QueryRow(`SELECT feed_id FROM feed_json WHERE items = 'posts'`).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// editing shows the URL without fragment
+	w = do(form, http.MethodGet, url.Values{"feed": {fmt.Sprint(id)}})
+	if got, want := w.Body.String(), fmt.Sprintf("%d %s posts ", id, api); got != want {
+		t.Errorf("edit form %q, want %q", got, want)
+	}
+	w = do(save, http.MethodPost, url.Values{"feed_id": {fmt.Sprint(id)}, "url": {api}, "items": {"entries"}, "title": {"name"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("updating JSON feed: %d %q", w.Code, w.Body.String())
+	}
+	var items string
+	err = db.QueryRow(`SELECT items FROM feed_json WHERE feed_id = ?`, id).Scan(&items)
+	if err != nil || items != "entries" {
+		t.Errorf("items path %q after update: %v", items, err)
+	}
+	// feeds of other kinds are not found
+	w = do(handlePageForm(db, f, scrapePage), http.MethodGet, url.Values{"feed": {fmt.Sprint(id)}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("scrape form of JSON feed: %d", w.Code)
+	}
+
+	// preview
+	body = `{"posts": [{"name": "First"}, {"name": "Second"}]}`
+	w = do(form, http.MethodGet, url.Values{"preview": {"1"}, "url": {api}, "items": {"posts"}, "title": {"name"}})
+	if got := w.Body.String(); !strings.HasSuffix(got, "First;Second;") {
+		t.Errorf("preview %q", got)
+	}
+	body = `{"posts": "` + strings.Repeat("x", maxFeedSize) + `"}`
+	w = do(form, http.MethodGet, url.Values{"preview": {"1"}, "url": {api}, "items": {"posts"}, "title": {"name"}})
+	if got := w.Body.String(); !strings.Contains(got, "exceeds") {
+		t.Errorf("preview of oversized document %.100q", got)
+	}
+}
+
+func TestPageSaveOtherKind(t *testing.T) {
+	db := testDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Test</title>
+<item><title>First</title><guid>1</guid><description>Summary</description></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	feedID := subscribeTestFeed(t, db, srv.URL)
+	f := newFetcher(db)
+	f.client = srv.Client()
+	fetchFeed(t, f, feedID)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a monitor form posted with the id of a regular feed
+	v := url.Values{"feed_id": {fmt.Sprint(feedID)}, "url": {srv.URL}, "selector": {"p"}}
+	r := httptest.NewRequest(http.MethodPost, "/monitor", strings.NewReader(v.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	withUser(userID)(handlePageSave(db, monitorPage)).ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("saving monitor of regular feed: %d, want 404", w.Code)
+	}
+	var summary sql.NullString
+	err = db.QueryRow(`SELECT summary FROM feed_item WHERE feed_id = ?`, feedID).Scan(&summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.String != "Summary" {
+		t.Errorf("item summary %v after rejected update", summary)
+	}
+	if etag, _ := validators(t, db, feedID); etag != `"v1"` {
+		t.Errorf("etag %q after rejected update", etag)
+	}
+}
@@ -1,16 +1,48 @@
 package main
 
 import (
+	"database/sql"
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"github.com/nochso/rss/discover"
 )
 
-func newRouter() http.Handler {
+func newRouter(db *sql.DB, userID int64, f *fetcher) http.Handler {
+	client := &http.Client{Timeout: fetchTimeout}
+	finder := &discover.Finder{
+		Client:    client,
+		UserAgent: userAgent,
+	}
 	r := chi.NewRouter()
+	r.Use(withUser(userID))
 	r.Handle("/static/*", http.StripPrefix("/static", http.FileServer(http.Dir("static"))))
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		render(w, r, "index.html", "")
-	})
+	r.Get("/", handleIndex(db))
+	r.Get("/item/{id}", handleItem(db))
+	r.Get("/feeds", handleFeeds(db))
+	r.Post("/feeds/{id}/enable", handleFeedEnable(db))
+	r.Post("/feeds/{id}/full-content", handleFullContent(db))
+	r.Post("/feeds/{id}/tags", handleTags(db))
+	r.Get("/tags/{name}/atom", handleTagFeed(db))
+	r.Post("/hub", handleHub(f.hub))
+	r.Get("/mail", handleMail(db))
+	r.Post("/mail", handleMailCreate(db))
+	r.Post("/mail/{id}/delete", handleMailDelete(db))
+	r.Get("/attachments/{hash}/{name}", handleAttachment(db))
+	r.Get("/subscribe", handleSubscribeForm(finder))
+	r.Post("/subscribe", handleSubscribe(db))
+	r.Get("/opml", handleOPMLExport(db))
+	r.Post("/opml", handleOPMLImport(db))
+	r.Get("/scrape", handlePageForm(db, f, scrapePage))
+	r.Post("/scrape", handlePageSave(db, scrapePage))
+	r.Get("/monitor", handlePageForm(db, f, monitorPage))
+	r.Post("/monitor", handlePageSave(db, monitorPage))
+	r.Get("/json", handlePageForm(db, f, jsonPage))
+	r.Post("/json", handlePageSave(db, jsonPage))
+	r.Get("/rules", handleRules(db))
+	r.Post("/rules", handleRuleSave(db))
+	r.Post("/rules/{id}/delete", handleRuleDelete(db))
+	r.Get("/websub/{id}", handleWebSubVerify(db))
+	r.Post("/websub/{id}", handleWebSubPush(db))
 	return r
 }
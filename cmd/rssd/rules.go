@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+	"github.com/nochso/rss/extract"
+)
+
+// extractRule is an extraction rule for all pages of a host.
+type extractRule struct {
+	ID   int64
+	Host string
+	extract.Rule
+}
+
+// rulesView is the data of the extraction rules page.
+type rulesView struct {
+	Rules []extractRule
+	Form  extractRule // rule being edited or added
+	Error string
+}
+
+func handleRules(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := rulesView{}
+		var err error
+		v.Rules, err = allRules(db)
+		if err != nil {
+			log.WithError(err).Error("selecting extraction rules")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if id, err := strconv.ParseInt(r.URL.Query().Get("edit"), 10, 64); err == nil {
+			for _, rule := range v.Rules {
+				if rule.ID == id {
+					v.Form = rule
+				}
+			}
+		}
+		render(w, r, "rules.html", v)
+	}
+}
+
+// handleRuleSave updates the edited rule, or adds a rule and replaces the
+// rule of the same host.
+func handleRuleSave(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule := extractRule{
+			Host: normalizeHost(r.PostFormValue("host")),
+			Rule: extract.Rule{
+				Content:  strings.TrimSpace(r.PostFormValue("content")),
+				Remove:   strings.TrimSpace(r.PostFormValue("remove")),
+				NextPage: strings.TrimSpace(r.PostFormValue("next_page")),
+			},
+		}
+		var err error
+		if id := r.PostFormValue("id"); id != "" {
+			rule.ID, err = strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		invalid := func(err error) {
+			rules, qerr := allRules(db)
+			if qerr != nil {
+				log.WithError(qerr).Error("selecting extraction rules")
+			}
+			renderStatus(w, r, http.StatusBadRequest, "rules.html", rulesView{Rules: rules, Form: rule, Error: err.Error()})
+		}
+		err = rule.Validate()
+		if err == nil && rule.Host == "" {
+			err = errHostRequired
+		}
+		if err != nil {
+			invalid(err)
+			return
+		}
+		if rule.ID != 0 {
+			err = updateRule(db, rule)
+		} else {
+			err = saveRule(db, rule)
+		}
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err == errHostTaken {
+			invalid(err)
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("host", rule.Host).Error("saving extraction rule")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/rules", http.StatusSeeOther)
+	}
+}
+
+func handleRuleDelete(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, err = db.Exec(`DELETE FROM extract_rule WHERE id = ?`, id)
+		if err != nil {
+			log.WithError(err).WithField("rule_id", id).Error("deleting extraction rule")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/rules", http.StatusSeeOther)
+	}
+}
+
+var (
+	errHostRequired = errors.New("a valid host name or URL is required")
+	errHostTaken    = errors.New("another rule exists for this host")
+)
+
+// normalizeHost returns the lower case host name of a host, host:port or URL
+// without port, e.g. "::1" for "http://[::1]:8080/". It returns an empty
+// string if s is not a valid host.
+func normalizeHost(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// findRule returns the rule for a host, or nil if there is none. A rule for
+// example.com also matches www.example.com.
+func findRule(db *sql.DB, host string) (*extractRule, error) {
+	host = strings.ToLower(host)
+	rule := &extractRule{}
+	err := db.QueryRow(`
+SELECT id, host, content, COALESCE(remove, ''), COALESCE(next_page, '')
+  FROM extract_rule
+ WHERE host IN (?, ?)
+ ORDER BY host = ? DESC
+ LIMIT 1`,
+		host,
+		strings.TrimPrefix(host, "www."),
+		host,
+	).Scan(&rule.ID, &rule.Host, &rule.Content, &rule.Remove, &rule.NextPage)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func allRules(db *sql.DB) ([]extractRule, error) {
+	rows, err := db.Query(`
+SELECT id, host, content, COALESCE(remove, ''), COALESCE(next_page, '')
+  FROM extract_rule
+ ORDER BY host`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []extractRule
+	for rows.Next() {
+		var rule extractRule
+		err = rows.Scan(&rule.ID, &rule.Host, &rule.Content, &rule.Remove, &rule.NextPage)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// saveRule inserts a rule or updates the existing rule of the host.
+func saveRule(db *sql.DB, rule extractRule) error {
+	_, err := db.Exec(`
+INSERT INTO extract_rule (host, content, remove, next_page)
+VALUES (?, ?, ?, ?)
+    ON CONFLICT (host) DO UPDATE
+   SET content = excluded.content,
+       remove = excluded.remove,
+       next_page = excluded.next_page`,
+		rule.Host,
+		rule.Content,
+		nullString(rule.Remove),
+		nullString(rule.NextPage),
+	)
+	return err
+}
+
+// updateRule changes the rule with the ID of rule. It returns sql.ErrNoRows
+// if there is no such rule and errHostTaken if another rule has the host.
+func updateRule(db *sql.DB, rule extractRule) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = updateRuleTx(tx, rule)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateRuleTx(tx *sql.Tx, rule extractRule) error {
+	var other int64
+	err := tx.QueryRow(`SELECT id FROM extract_rule WHERE host = ? AND id != ?`, rule.Host, rule.ID).Scan(&other)
+	if err == nil {
+		return errHostTaken
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	res, err := tx.Exec(`
+UPDATE extract_rule
+   SET host = ?,
+       content = ?,
+       remove = ?,
+       next_page = ?
+ WHERE id = ?`,
+		rule.Host,
+		rule.Content,
+		nullString(rule.Remove),
+		nullString(rule.NextPage),
+		rule.ID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{" Example.COM ", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"example.com/path?q=1#top", "example.com"},
+		{"https://www.example.com/blog/", "www.example.com"},
+		{"http://user@example.com:8080", "example.com"},
+		{"127.0.0.1:8080", "127.0.0.1"},
+		{"::1", "::1"},
+		{"2001:DB8::1", "2001:db8::1"},
+		{"[::1]", "::1"},
+		{"[::1]:8080", "::1"},
+		{"http://[2001:db8::1]:8080/feed", "2001:db8::1"},
+		{"", ""},
+		{"exa mple.com", ""},
+	}
+	for _, test := range tests {
+		if got := normalizeHost(test.in); got != test.want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRuleSave(t *testing.T) {
+	db := testDB(t)
+	saved := templates
+	defer func() { templates = saved }()
+	templates = map[string]*template.Template{
+		"rules.html": template.Must(template.New("rules.html").Parse(`{{.Form.ID}} {{.Form.Host}} {{.Error}}`)),
+	}
+	save := func(v url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handleRuleSave(db).ServeHTTP(w, r)
+		return w
+	}
+	rules := func() []string {
+		t.Helper()
+		all, err := allRules(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, r := range all {
+			s = append(s, r.Host+" "+r.Content)
+		}
+		return s
+	}
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		rules  []string
+	}{
+		{"add", url.Values{"host": {"https://Example.com/"}, "content": {"article"}}, http.StatusSeeOther, []string{"example.com article"}},
+		{"add IPv6", url.Values{"host": {"[::1]:8080"}, "content": {"main"}}, http.StatusSeeOther, []string{"::1 main", "example.com article"}},
+		{"replace same host", url.Values{"host": {"example.com"}, "content": {".post"}}, http.StatusSeeOther, []string{"::1 main", "example.com .post"}},
+		{"edit host", url.Values{"id": {"1"}, "host": {"example.org"}, "content": {".entry"}}, http.StatusSeeOther, []string{"::1 main", "example.org .entry"}},
+		{"edit onto other rule", url.Values{"id": {"1"}, "host": {"::1"}, "content": {".entry"}}, http.StatusBadRequest, []string{"::1 main", "example.org .entry"}},
+		{"edit unknown rule", url.Values{"id": {"99"}, "host": {"example.net"}, "content": {".entry"}}, http.StatusNotFound, []string{"::1 main", "example.org .entry"}},
+		{"invalid host", url.Values{"host": {"exa mple.com"}, "content": {"article"}}, http.StatusBadRequest, []string{"::1 main", "example.org .entry"}},
+	}
+	for _, test := range tests {
+		w := save(test.form)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, w.Code, test.status, w.Body)
+		}
+		if got := rules(); !reflect.DeepEqual(got, test.rules) {
+			t.Errorf("%s: rules %q, want %q", test.name, got, test.rules)
+		}
+	}
+	// the form keeps the edited rule after an error
+	w := save(url.Values{"id": {"1"}, "host": {"::1"}, "content": {".entry"}})
+	if want := "1 ::1 " + errHostTaken.Error(); w.Body.String() != want {
+		t.Errorf("form %q, want %q", w.Body, want)
+	}
+}
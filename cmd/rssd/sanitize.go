@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/nochso/rss/sanitize"
+)
+
+// sanitizeBatch is the maximum amount of items sanitized per transaction.
+const sanitizeBatch = 500
+
+// itemBase returns the URL that relative URLs of an item are resolved
+// against: the item link, or the feed link if the item has none. Items
+// without either, like mail, may only link to paths on rssd such as their
+// attachments.
+func itemBase(link, feedLink string) *url.URL {
+	for _, l := range []string{link, feedLink} {
+		u, err := url.Parse(l)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			return u
+		}
+	}
+	return &url.URL{Path: "/"}
+}
+
+// resanitize sanitizes items again that were stored with an older version of
+// the sanitizer. It returns the amount of updated items.
+func resanitize(db *sql.DB) (int, error) {
+	total := 0
+	for {
+		n, err := resanitizeBatch(db)
+		total += n
+		if err != nil || n < sanitizeBatch {
+			return total, err
+		}
+	}
+}
+
+func resanitizeBatch(db *sql.DB) (int, error) {
+	type item struct {
+		id                                         int64
+		summary, content, extracted, link, feedURL string
+	}
+	rows, err := db.Query(`
+SELECT i.id, COALESCE(i.summary, ''), COALESCE(i.content, ''), COALESCE(i.extracted, ''),
+       COALESCE(i.link, ''), COALESCE(f.link, '')
+  FROM feed_item i
+  JOIN feed f ON f.id = i.feed_id
+ WHERE i.sanitizer_version < ?
+ LIMIT ?`, sanitize.Version, sanitizeBatch)
+	if err != nil {
+		return 0, err
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		err = rows.Scan(&it.id, &it.summary, &it.content, &it.extracted, &it.link, &it.feedURL)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		base := itemBase(it.link, it.feedURL)
+		_, err = tx.Exec(`
+UPDATE feed_item
+   SET summary_html = ?,
+       content_html = ?,
+       extracted_html = ?,
+       sanitizer_version = ?
+ WHERE id = ?`,
+			sanitize.HTML(it.summary, base),
+			sanitize.HTML(it.content, base),
+			nullString(sanitize.HTML(it.extracted, base)),
+			sanitize.Version,
+			it.id,
+		)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(items), tx.Commit()
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cadenceItems is the amount of recent items used to estimate how often a
+// feed publishes.
+const cadenceItems = 10
+
+// schedule computes when feeds are fetched next.
+type schedule struct {
+	def time.Duration // interval used when nothing is known about a feed
+	min time.Duration
+	max time.Duration
+}
+
+// scheduleHints are everything known about how often a feed should be
+// fetched.
+type scheduleHints struct {
+	cadence    time.Duration // estimated time between new items
+	ttl        time.Duration // minimum interval requested by the feed
+	maxAge     time.Duration // Cache-Control max-age of the last response
+	retryAfter time.Duration // Retry-After of the last response
+	skipHours  []int
+	skipDays   []time.Weekday
+	// push is true if new items are pushed by a WebSub hub, so fetching is
+	// only a fallback
+	push bool
+}
+
+// next returns the time the feed should be fetched after now.
+//
+// The largest of cadence, TTL and max-age is bounded by min and max. Feeds
+// with pushed updates are fetched at max. Servers asking to retry later are
+// honoured even beyond max. Finally skipped hours and days are avoided.
+func (s schedule) next(now time.Time, h scheduleHints) time.Time {
+	d := h.cadence
+	if d == 0 {
+		d = s.def
+	}
+	if h.ttl > d {
+		d = h.ttl
+	}
+	if h.maxAge > d {
+		d = h.maxAge
+	}
+	if d < s.min {
+		d = s.min
+	}
+	if d > s.max || h.push {
+		d = s.max
+	}
+	if h.retryAfter > d {
+		d = h.retryAfter
+	}
+	next := now.Add(d)
+	if len(h.skipHours) == 0 && len(h.skipDays) == 0 {
+		return next
+	}
+	// move to the start of the next hour that is not skipped, giving up
+	// after a week in case everything is skipped
+	for i := 0; i < 7*24 && isSkipped(next.UTC(), h); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+// backoff returns the time of the next attempt after consecutive failures.
+// The interval starts at min and doubles with every failure up to max.
+func (s schedule) backoff(now time.Time, failures int, retryAfter time.Duration) time.Time {
+	d := s.min
+	for i := 1; i < failures && d < s.max; i++ {
+		d *= 2
+	}
+	if d > s.max {
+		d = s.max
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return now.Add(d)
+}
+
+func isSkipped(t time.Time, h scheduleHints) bool {
+	for _, hour := range h.skipHours {
+		if t.Hour() == hour {
+			return true
+		}
+	}
+	for _, day := range h.skipDays {
+		if t.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleFeed sets the next fetch time of a feed based on the hints of the
+// last response and the feed's stored state.
+func scheduleFeed(db *sql.DB, s schedule, id int64, cache httpCache, now time.Time) (time.Time, error) {
+	h := scheduleHints{
+		maxAge:     cache.maxAge,
+		retryAfter: cache.retryAfter,
+	}
+	var ttl int64
+	var skipHours, skipDays string
+	err := db.QueryRow(
+		`SELECT COALESCE(ttl, 0), COALESCE(skip_hours, ''), COALESCE(skip_days, '') FROM feed WHERE id = ?`,
+		id,
+	).Scan(&ttl, &skipHours, &skipDays)
+	if err != nil {
+		return time.Time{}, err
+	}
+	h.ttl = time.Duration(ttl) * time.Second
+	h.skipHours = splitInts(skipHours)
+	for _, i := range splitInts(skipDays) {
+		h.skipDays = append(h.skipDays, time.Weekday(i))
+	}
+	err = db.QueryRow(
+		`SELECT COUNT(*) > 0 FROM websub WHERE feed_id = ? AND lease_expires > ?`,
+		id,
+		now,
+	).Scan(&h.push)
+	if err != nil {
+		return time.Time{}, err
+	}
+	h.cadence, err = feedCadence(db, id, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := s.next(now, h)
+	return next, setNextFetch(db, id, next)
+}
+
+// feedCadence estimates the time between new items using the most recent
+// items. The time since the newest item is included so that feeds which went
+// quiet are fetched less often. Zero is returned if the feed has no items.
+func feedCadence(db *sql.DB, id int64, now time.Time) (time.Duration, error) {
+	rows, err := db.Query(`
+SELECT published
+  FROM feed_item
+ WHERE feed_id = ?
+ ORDER BY published DESC
+ LIMIT ?`, id, cadenceItems)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var oldest time.Time
+	var n int
+	for rows.Next() {
+		if err = rows.Scan(&oldest); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil || n == 0 {
+		return 0, err
+	}
+	d := now.Sub(oldest) / time.Duration(n)
+	if d < 0 {
+		return 0, nil
+	}
+	return d, nil
+}
+
+// parseMaxAge returns the max-age directive of a Cache-Control header.
+func parseMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+		if err != nil || sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	return 0
+}
+
+// parseRetryAfter returns the delay of a Retry-After header which is either
+// in seconds or a HTTP date.
+func parseRetryAfter(retryAfter string, now time.Time) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+	if sec, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	t, err := http.ParseTime(retryAfter)
+	if err != nil || t.Before(now) {
+		return 0
+	}
+	return t.Sub(now)
+}
+
+// joinInts returns a comma separated list of integers.
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// splitInts parses a list created by joinInts, ignoring invalid numbers.
+func splitInts(s string) []int {
+	var ints []int
+	for _, part := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(part); err == nil {
+			ints = append(ints, n)
+		}
+	}
+	return ints
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var testSchedule = schedule{def: time.Hour, min: 10 * time.Minute, max: 24 * time.Hour}
+
+func TestScheduleNext(t *testing.T) {
+	// a Monday
+	now := time.Date(2018, 1, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		hints scheduleHints
+		want  time.Time
+	}{
+		{"default", scheduleHints{}, now.Add(time.Hour)},
+		{"cadence", scheduleHints{cadence: 3 * time.Hour}, now.Add(3 * time.Hour)},
+		{"min", scheduleHints{cadence: time.Minute}, now.Add(10 * time.Minute)},
+		{"max", scheduleHints{cadence: 30 * 24 * time.Hour}, now.Add(24 * time.Hour)},
+		{"ttl", scheduleHints{cadence: time.Hour, ttl: 2 * time.Hour}, now.Add(2 * time.Hour)},
+		{"ttl below cadence", scheduleHints{cadence: 3 * time.Hour, ttl: 2 * time.Hour}, now.Add(3 * time.Hour)},
+		{"ttl above max", scheduleHints{ttl: 48 * time.Hour}, now.Add(24 * time.Hour)},
+		{"max-age", scheduleHints{cadence: time.Hour, maxAge: 5 * time.Hour}, now.Add(5 * time.Hour)},
+		{"max-age below min", scheduleHints{cadence: time.Minute, maxAge: 5 * time.Minute}, now.Add(10 * time.Minute)},
+		{"retry after", scheduleHints{retryAfter: 2 * time.Hour}, now.Add(2 * time.Hour)},
+		{"retry after beyond max", scheduleHints{retryAfter: 48 * time.Hour}, now.Add(48 * time.Hour)},
+		{"push", scheduleHints{cadence: 20 * time.Minute, push: true}, now.Add(24 * time.Hour)},
+		{"push with retry after", scheduleHints{push: true, retryAfter: 36 * time.Hour}, now.Add(36 * time.Hour)},
+		{"skip hours", scheduleHints{skipHours: []int{13, 14}}, time.Date(2018, 1, 1, 15, 0, 0, 0, time.UTC)},
+		{"skip hours not hit", scheduleHints{skipHours: []int{0}}, now.Add(time.Hour)},
+		{"skip days", scheduleHints{cadence: 12 * time.Hour, skipDays: []time.Weekday{time.Tuesday}}, time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"skip hours and days", scheduleHints{cadence: 12 * time.Hour, skipHours: []int{0, 1}, skipDays: []time.Weekday{time.Tuesday}}, time.Date(2018, 1, 3, 2, 0, 0, 0, time.UTC)},
+		{"everything skipped", scheduleHints{skipDays: []time.Weekday{0, 1, 2, 3, 4, 5, 6}}, time.Date(2018, 1, 8, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := testSchedule.next(now, test.hints); !got.Equal(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextSkipsInUTC(t *testing.T) {
+	// 13:30 UTC
+	now := time.Date(2018, 1, 1, 14, 30, 0, 0, time.FixedZone("CET", 3600))
+	got := testSchedule.next(now, scheduleHints{skipHours: []int{14}})
+	if want := time.Date(2018, 1, 1, 15, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures   int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{1, 0, 10 * time.Minute},
+		{2, 0, 20 * time.Minute},
+		{3, 0, 40 * time.Minute},
+		{8, 0, 1280 * time.Minute},
+		{9, 0, 24 * time.Hour},
+		{100, 0, 24 * time.Hour},
+		{1, time.Hour, time.Hour},
+		{1, time.Minute, 10 * time.Minute},
+		{100, 48 * time.Hour, 48 * time.Hour},
+	}
+	for _, test := range tests {
+		got := testSchedule.backoff(now, test.failures, test.retryAfter)
+		if want := now.Add(test.want); !got.Equal(want) {
+			t.Errorf("backoff(%d, %v) = %v, want %v", test.failures, test.retryAfter, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"Mon, 01 Jan 2018 13:00:00 GMT", time.Hour},
+		{"Monday, 01-Jan-18 12:30:00 GMT", 30 * time.Minute},
+		{"Mon, 01 Jan 2018 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.in, now); got != test.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseMaxAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"max-age=300", 5 * time.Minute},
+		{"public, max-age=3600, must-revalidate", time.Hour},
+		{"s-maxage=60, max-age=120", 2 * time.Minute},
+		{"max-age=-1", 0},
+		{"max-age=abc", 0},
+		{"no-cache", 0},
+	}
+	for _, test := range tests {
+		if got := parseMaxAge(test.in); got != test.want {
+			t.Errorf("parseMaxAge(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/scrape"
+)
+
+// scrapePage is the kind of feeds scraped from web pages.
+var scrapePage = pageKind{
+	kind: kindScrape,
+	tmpl: "scrape.html",
+	name: "scraped feed",
+	form: func() pageForm { return &scrapeView{} },
+}
+
+// scrapeView is the data of the page for creating and editing scraped feeds.
+type scrapeView struct {
+	pageView
+	Config  scrape.Config
+	Preview *feed.Feed
+}
+
+func (v *scrapeView) read(get func(string) string) {
+	v.Config = scrape.Config{
+		Item:  strings.TrimSpace(get("item")),
+		Title: strings.TrimSpace(get("title")),
+		Link:  strings.TrimSpace(get("link")),
+		Date:  strings.TrimSpace(get("date")),
+	}
+}
+
+func (v *scrapeView) validate() error {
+	return v.Config.Validate()
+}
+
+func (v *scrapeView) find(db *sql.DB, feedID int64) error {
+	var err error
+	v.Config, err = findScrapeConfig(db, feedID)
+	return err
+}
+
+// preview downloads and scrapes the page.
+func (v *scrapeView) preview(ctx context.Context, f *fetcher) error {
+	var err error
+	v.Preview, _, err = f.download(ctx, v.URL, httpCache{}, v.Config.Parser())
+	return err
+}
+
+func (v *scrapeView) insert(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(`
+INSERT INTO feed_scrape (feed_id, item, title, link, date)
+VALUES (?, ?, ?, ?, ?)`,
+		feedID,
+		v.Config.Item,
+		nullString(v.Config.Title),
+		nullString(v.Config.Link),
+		nullString(v.Config.Date),
+	)
+	return err
+}
+
+func (v *scrapeView) update(tx *sql.Tx, feedID int64) error {
+	_, err := tx.Exec(`
+UPDATE feed_scrape
+   SET item = ?,
+       title = ?,
+       link = ?,
+       date = ?
+ WHERE feed_id = ?`,
+		v.Config.Item,
+		nullString(v.Config.Title),
+		nullString(v.Config.Link),
+		nullString(v.Config.Date),
+		feedID,
+	)
+	return err
+}
+
+// findScrapeConfig returns the selectors of a scraped feed.
+func findScrapeConfig(db *sql.DB, feedID int64) (scrape.Config, error) {
+	var c scrape.Config
+	err := db.QueryRow(`
+SELECT item, COALESCE(title, ''), COALESCE(link, ''), COALESCE(date, '')
+  FROM feed_scrape
+ WHERE feed_id = ?`, feedID).Scan(&c.Item, &c.Title, &c.Link, &c.Date)
+	return c, err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nochso/rss/scrape"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>Releases</title></head><body>
+<ul class="releases">
+<li><a href="/v2">Version 2</a> <span class="note">Second</span></li>
+<li><a href="/v1">Version 1</a> <span class="note">First</span></li>
+</ul>
+</body></html>`
+
+func TestScrapeFeedsOfSamePage(t *testing.T) {
+	db := testDB(t)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.String())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, testPage)
+	}))
+	defer srv.Close()
+	page := srv.URL + "/releases"
+
+	// the page is a regular feed already and scraped by two configurations
+	subscribeTestFeed(t, db, page)
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := []scrape.Config{
+		{Item: "ul.releases > li", Title: "a"},
+		{Item: "ul.releases > li", Title: ".note"},
+	}
+	for _, c := range configs {
+		err = createPageFeed(db, userID, kindScrape, &scrapeView{pageView: pageView{URL: page}, Config: c})
+		if err != nil {
+			t.Fatalf("creating second feed of the same page: %v", err)
+		}
+	}
+
+	f := newFetcher(db)
+	f.client = srv.Client()
+	rows, err := db.Query(`SELECT id FROM feed WHERE kind = ? ORDER BY id`, kindScrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) != 2 {
+		t.Fatalf("%d scraped feeds, want 2", len(ids))
+	}
+	for i, id := range ids {
+		v := &scrapeView{}
+		if err = findPageFeed(db, kindScrape, id, v); err != nil {
+			t.Fatal(err)
+		}
+		if v.URL != page {
+			t.Errorf("feed %d: page URL %q, want %q", id, v.URL, page)
+		}
+		fetchFeed(t, f, id)
+		var title, link string
+		err = db.QueryRow(`SELECT title, link FROM feed_item WHERE feed_id = ? AND link LIKE '%/v1'`, id).Scan(&title, &link)
+		if err != nil {
+			t.Fatalf("feed %d: %v", id, err)
+		}
+		if want := []string{"Version 1", "First"}[i]; title != want || link != srv.URL+"/v1" {
+			t.Errorf("feed %d: item %q %q, want %q %q", id, title, link, want, srv.URL+"/v1")
+		}
+	}
+	for _, p := range paths {
+		if p != "/releases" {
+			t.Errorf("requested %q, want /releases", p)
+		}
+	}
+}
+
+func TestScrapePreview(t *testing.T) {
+	db := testDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, testPage)
+	}))
+	defer srv.Close()
+	saved := templates
+	defer func() { templates = saved }()
+	templates = map[string]*template.Template{
+		"scrape.html": template.Must(template.New("scrape.html").Parse(
+			`{{.Error}}{{with .Preview}}{{range .Items}}{{.Title}} {{.Link}};{{end}}{{end}}`,
+		)),
+	}
+	f := newFetcher(db)
+	f.client = srv.Client()
+	h := handlePageForm(db, f, scrapePage)
+
+	q := url.Values{
+		"preview": {"1"},
+		"url":     {srv.URL + "/releases"},
+		"item":    {"ul.releases > li"},
+	}
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/scrape?"+q.Encode(), nil))
+	want := fmt.Sprintf("Version 2 %[1]s/v2;Version 1 %[1]s/v1;", srv.URL)
+	if got := w.Body.String(); got != want {
+		t.Errorf("preview %q, want %q", got, want)
+	}
+
+	q.Set("url", srv.URL+"/missing")
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/scrape?"+q.Encode(), nil))
+	if got := w.Body.String(); !strings.Contains(got, "404") {
+		t.Errorf("preview of missing page %q, want HTTP status error", got)
+	}
+}
+
+func TestScrapeFeedTitle(t *testing.T) {
+	db := testDB(t)
+	title := "Releases"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, strings.Replace(testPage, "Releases", title, 1))
+	}))
+	defer srv.Close()
+	userID, err := ensureUser(db, "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &scrapeView{pageView: pageView{URL: srv.URL}, Config: scrape.Config{Item: "ul.releases > li"}}
+	if err = createPageFeed(db, userID, kindScrape, v); err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err = db.QueryRow(`SELECT id FROM feed WHERE kind = ?`, kindScrape).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	feedTitle := func() string {
+		t.Helper()
+		var s string
+		if err := db.QueryRow(`SELECT title FROM feed WHERE id = ?`, id).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	f := newFetcher(db)
+	f.client = srv.Client()
+	fetchFeed(t, f, id)
+	if got := feedTitle(); got != "Releases" {
+		t.Errorf("title %q after first fetch, want page title", got)
+	}
+	title = "Releases (3 new)"
+	fetchFeed(t, f, id)
+	if got := feedTitle(); got != "Releases" {
+		t.Errorf("title %q after page title changed, want %q", got, "Releases")
+	}
+}
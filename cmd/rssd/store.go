@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/nochso/rss/feed"
+	"github.com/nochso/rss/sanitize"
+)
+
+// touchFeed marks a feed as successfully updated without changing its
+// content.
+func touchFeed(db *sql.DB, id int64, status int, now time.Time) error {
+	_, err := db.Exec(`
+UPDATE feed
+   SET last_update = ?1,
+       last_success = ?1,
+       http_status = ?2,
+       error_count = 0,
+       last_error = NULL
+ WHERE id = ?3`,
+		now,
+		nullInt(int64(status)),
+		id,
+	)
+	return err
+}
+
+// failFeed records a failed update. status is the HTTP status of the
+// response or zero if there was none. The feed is disabled once maxFailures
+// consecutive failures are reached, unless maxFailures is zero.
+//
+// The amount of consecutive failures is returned and whether the feed is now
+// disabled.
+func failFeed(db *sql.DB, id int64, status int, msg string, maxFailures int, now time.Time) (int, bool, error) {
+	_, err := db.Exec(`
+UPDATE feed
+   SET last_update = ?1,
+       http_status = ?2,
+       error_count = error_count + 1,
+       last_error = ?3,
+       disabled = CASE
+                  WHEN ?4 > 0 AND error_count + 1 >= ?4 THEN 1
+                  ELSE disabled
+                  END
+ WHERE id = ?5`,
+		now,
+		nullInt(int64(status)),
+		msg,
+		maxFailures,
+		id,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	var failures int
+	var disabled bool
+	err = db.QueryRow(`SELECT error_count, disabled FROM feed WHERE id = ?`, id).Scan(&failures, &disabled)
+	return failures, disabled, err
+}
+
+// setNextFetch schedules the next update of a feed.
+func setNextFetch(db *sql.DB, id int64, next time.Time) error {
+	_, err := db.Exec(`UPDATE feed SET next_fetch = ? WHERE id = ?`, next, id)
+	return err
+}
+
+// storeFeed updates the feed's details and inserts or updates its items
+// within a single transaction. The title of feeds created from web pages is
+// only set from the page if it is empty, as page titles tend to change.
+func storeFeed(db *sql.DB, id int64, doc *feed.Feed, cache httpCache, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storeFeedTx(tx, id, doc, cache, now)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func storeFeedTx(tx *sql.Tx, id int64, doc *feed.Feed, cache httpCache, now time.Time) error {
+	_, err := tx.Exec(`
+UPDATE feed
+   SET title = CASE WHEN kind = ? OR title = '' THEN ? ELSE title END,
+       link = ?,
+       description = ?,
+       language = ?,
+       last_update = ?,
+       last_success = ?,
+       error_count = 0,
+       last_error = NULL,
+       etag = ?,
+       last_modified = ?,
+       http_status = ?,
+       ttl = ?,
+       skip_hours = ?,
+       skip_days = ?,
+       parse_warnings = ?
+ WHERE id = ?`,
+		kindFeed,
+		doc.Title,
+		doc.Link,
+		doc.Description,
+		doc.Language,
+		now,
+		now,
+		cache.etag,
+		cache.lastModified,
+		nullInt(int64(cache.status)),
+		nullInt(int64(doc.TTL.Seconds())),
+		joinInts(doc.SkipHours),
+		joinInts(weekdayInts(doc.SkipDays)),
+		nullString(strings.Join(doc.Warnings, "\n")),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	for _, item := range doc.Items {
+		err = storeItemTx(tx, id, doc.Link, item, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storePushed inserts or updates the items of a document pushed by a hub.
+// Unlike storeFeed the details of the feed are kept, as pushed documents
+// often contain only new items and no HTTP validators.
+func storePushed(db *sql.DB, id int64, doc *feed.Feed, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storePushedTx(tx, id, doc, now)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func storePushedTx(tx *sql.Tx, id int64, doc *feed.Feed, now time.Time) error {
+	var link string
+	err := tx.QueryRow(`SELECT COALESCE(link, '') FROM feed WHERE id = ?`, id).Scan(&link)
+	if err != nil {
+		return err
+	}
+	if doc.Link != "" {
+		link = doc.Link
+	}
+	for _, item := range doc.Items {
+		err = storeItemTx(tx, id, link, item, now)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE feed SET last_update = ? WHERE id = ?`, now, id)
+	return err
+}
+
+// storeItemTx inserts or updates a single item and its categories.
+//
+// Summary and content are stored as-is and sanitized for rendering. feedLink
+// is the website of the feed.
+func storeItemTx(tx *sql.Tx, feedID int64, feedLink string, item *feed.Item, now time.Time) error {
+	// keep the first known date if the item has none
+	var published interface{}
+	if !item.Published.IsZero() {
+		published = item.Published.UTC()
+	}
+	base := itemBase(item.Link, feedLink)
+	_, err := tx.Exec(`
+INSERT INTO feed_item (
+    feed_id, guid, title, link, published, last_update,
+    summary, content, author_name, author_email,
+    image, episode, season,
+    summary_html, content_html, sanitizer_version
+)
+VALUES (?1, ?2, ?3, ?4, COALESCE(?5, ?6), ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15, ?16)
+    ON CONFLICT (guid, feed_id) DO UPDATE
+   SET title = excluded.title,
+       link = excluded.link,
+       published = COALESCE(?5, published),
+       last_update = excluded.last_update,
+       summary = excluded.summary,
+       content = excluded.content,
+       author_name = excluded.author_name,
+       author_email = excluded.author_email,
+       image = excluded.image,
+       episode = excluded.episode,
+       season = excluded.season,
+       summary_html = excluded.summary_html,
+       content_html = excluded.content_html,
+       sanitizer_version = excluded.sanitizer_version`,
+		feedID,
+		item.GUID,
+		item.Title,
+		item.Link,
+		published,
+		now,
+		item.Description,
+		item.Content,
+		item.Author.Name,
+		item.Author.Email,
+		item.Image,
+		nullInt(int64(item.Episode)),
+		nullInt(int64(item.Season)),
+		sanitize.HTML(item.Description, base),
+		sanitize.HTML(item.Content, base),
+		sanitize.Version,
+	)
+	if err != nil {
+		return err
+	}
+	var itemID int64
+	err = tx.QueryRow(
+		`SELECT id FROM feed_item WHERE guid = ? AND feed_id = ?`,
+		item.GUID,
+		feedID,
+	).Scan(&itemID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM feed_item_category WHERE feed_item_id = ?`, itemID)
+	if err != nil {
+		return err
+	}
+	for _, c := range item.Categories {
+		_, err = tx.Exec(
+			`INSERT INTO feed_item_category (feed_item_id, name) VALUES (?, ?)`,
+			itemID,
+			c,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM feed_item_enclosure WHERE feed_item_id = ?`, itemID)
+	if err != nil {
+		return err
+	}
+	for _, e := range item.Enclosures {
+		_, err = tx.Exec(`
+INSERT INTO feed_item_enclosure (feed_item_id, url, type, length, title, duration)
+VALUES (?, ?, ?, ?, ?, ?)`,
+			itemID,
+			e.URL,
+			e.Type,
+			nullInt(e.Length),
+			e.Title,
+			nullInt(int64(e.Duration.Seconds())),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// weekdayInts converts weekdays to integers starting with Sunday as zero.
+func weekdayInts(days []time.Weekday) []int {
+	ints := make([]int, len(days))
+	for i, d := range days {
+		ints[i] = int(d)
+	}
+	return ints
+}
+
+// nullInt returns nil for zero so it's stored as NULL.
+func nullInt(i int64) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// nullString returns nil for empty strings so they're stored as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/nochso/rss/discover"
+	"github.com/nochso/rss/feed"
+)
+
+// subscribeView is the data of the add subscription page.
+type subscribeView struct {
+	URL   string
+	Feeds []discover.Feed
+	Error string
+}
+
+// handleSubscribeForm shows a form for a website URL and the feeds that were
+// discovered for it.
+func handleSubscribeForm(finder *discover.Finder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := subscribeView{URL: strings.TrimSpace(r.URL.Query().Get("url"))}
+		if v.URL != "" {
+			var err error
+			v.Feeds, err = finder.Find(r.Context(), v.URL)
+			if err != nil {
+				log.WithError(err).WithField("url", v.URL).Info("discovering feeds")
+				v.Error = err.Error()
+			} else if len(v.Feeds) == 0 {
+				v.Error = "No feeds found."
+			}
+		}
+		render(w, r, "subscribe.html", v)
+	}
+}
+
+// handleSubscribe subscribes the user to the chosen feed.
+func handleSubscribe(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := strings.TrimSpace(r.PostFormValue("feed_link"))
+		if !feed.IsHTTP(link) {
+			http.Error(w, "invalid feed URL", http.StatusBadRequest)
+			return
+		}
+		_, err := subscribe(db, userID(r), link, strings.TrimSpace(r.PostFormValue("title")))
+		if err != nil {
+			log.WithError(err).WithField("feed_link", link).Error("subscribing to feed")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+// subscribe adds a subscription to the feed with the given URL, creating the
+// feed if necessary. It returns the id of the subscription.
+func subscribe(db *sql.DB, userID int64, link, title string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := subscribeTx(tx, userID, link, title)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func subscribeTx(tx *sql.Tx, userID int64, link, title string) (int64, error) {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO feed (title, feed_link) VALUES (?, ?)`, title, link)
+	if err != nil {
+		return 0, err
+	}
+	var feedID int64
+	err = tx.QueryRow(`SELECT id FROM feed WHERE feed_link = ?`, link).Scan(&feedID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT OR IGNORE INTO subscription (user_id, feed_id) VALUES (?, ?)`, userID, feedID)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRow(
+		`SELECT id FROM subscription WHERE user_id = ? AND feed_id = ?`,
+		userID,
+		feedID,
+	).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+)
+
+// tagFeedLimit is the maximum amount of items in a tag feed.
+const tagFeedLimit = 50
+
+// tagView is a tag of a subscription.
+type tagView struct {
+	Name    string
+	FeedURL string // path of the Atom feed of the tag
+}
+
+func newTagView(name string) tagView {
+	return tagView{Name: name, FeedURL: tagFeedPath(name)}
+}
+
+// tagFeedPath returns the path of the Atom feed of a tag, relative to the
+// root of rssd.
+func tagFeedPath(name string) string {
+	return "/tags/" + url.PathEscape(name) + "/atom"
+}
+
+// handleTags replaces the tags of the user's subscription to a feed with a
+// comma separated list.
+func handleTags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		err = setTags(db, userID(r), id, splitTags(r.PostFormValue("tags")))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("feed_id", id).Error("changing tags")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	}
+}
+
+// splitTags returns the unique, non-empty tags of a comma separated list.
+func splitTags(s string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.Join(strings.Fields(t), " ")
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// setTags replaces the tags of a subscription. sql.ErrNoRows is returned if
+// the user is not subscribed to the feed.
+func setTags(db *sql.DB, userID, feedID int64, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = setTagsTx(tx, userID, feedID, tags)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func setTagsTx(tx *sql.Tx, userID, feedID int64, tags []string) error {
+	var subID int64
+	err := tx.QueryRow(`SELECT id FROM subscription WHERE user_id = ? AND feed_id = ?`, userID, feedID).Scan(&subID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM subscription_tag WHERE subscription_id = ?`, subID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		err = addTagTx(tx, subID, t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTagTx adds a tag to a subscription, creating the tag if necessary.
+func addTagTx(tx *sql.Tx, subID int64, tag string) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO tag (name) VALUES (?)`, tag)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+INSERT OR IGNORE INTO subscription_tag (subscription_id, tag_id)
+SELECT ?, id FROM tag WHERE name = ?`, subID, tag)
+	return err
+}
+
+// handleTagFeed serves the latest items of all feeds the user tagged with a
+// tag as an Atom feed. The feed advertises the built-in hub.
+func handleTagFeed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, err := url.PathUnescape(chi.URLParam(r, "name"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var exists bool
+		err = db.QueryRow(`SELECT COUNT(*) > 0 FROM tag WHERE name = ?`, name).Scan(&exists)
+		if err == nil && !exists {
+			http.NotFound(w, r)
+			return
+		}
+		var items []publishedItem
+		if err == nil {
+			items, err = tagItems(db, userID(r), name)
+		}
+		if err != nil {
+			log.WithError(err).WithField("tag", name).Error("selecting tag feed")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		base := publicURL(r)
+		self := base.ResolveReference(&url.URL{Path: strings.TrimPrefix(tagFeedPath(name), "/")}).String()
+		hubURL := base.ResolveReference(&url.URL{Path: "hub"}).String()
+		w.Header().Add("Link", "<"+hubURL+`>; rel="hub"`)
+		w.Header().Add("Link", "<"+self+`>; rel="self"`)
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		err = writeAtom(w, base, "Tag: "+name, self, hubURL, items)
+		if err != nil {
+			log.WithError(err).WithField("tag", name).Warn("writing tag feed")
+		}
+	}
+}
+
+// publishedItem is an item of a feed served by rssd.
+type publishedItem struct {
+	ID        int64
+	FeedTitle string
+	Title     string
+	Link      string
+	Published time.Time
+	Updated   time.Time
+	Author    string
+	Body      string // sanitized HTML
+}
+
+// tagItemsQuery selects items of the user's subscriptions tagged with a
+// name and newer than an item ID. The order is filled in by the callers.
+const tagItemsQuery = `
+SELECT i.id, f.title, i.title, i.link, i.published, i.last_update, COALESCE(i.author_name, ''),
+       COALESCE(
+           CASE WHEN s.full_content THEN NULLIF(i.extracted_html, '') END,
+           NULLIF(i.content_html, ''),
+           i.summary_html,
+           ''
+       )
+  FROM feed_item i
+  JOIN feed f ON f.id = i.feed_id
+  JOIN subscription s ON s.feed_id = i.feed_id AND s.user_id = ?
+  JOIN subscription_tag st ON st.subscription_id = s.id
+  JOIN tag t ON t.id = st.tag_id
+ WHERE t.name = ?
+   AND i.id > ?
+ ORDER BY %s
+ LIMIT ?`
+
+// tagItems returns the latest items of the user's subscriptions tagged with
+// name.
+func tagItems(db *sql.DB, userID int64, name string) ([]publishedItem, error) {
+	return queryTagItems(db, "i.published DESC, i.id DESC", userID, name, 0)
+}
+
+// tagItemsAfter returns the items of the user's subscriptions tagged with
+// name in the order they were stored, starting after the item afterID.
+// Items are only delivered once, so unlike tagItems the order must not
+// depend on the publication date: items published in the past may be
+// stored at any time.
+func tagItemsAfter(db *sql.DB, userID int64, name string, afterID int64) ([]publishedItem, error) {
+	return queryTagItems(db, "i.id ASC", userID, name, afterID)
+}
+
+func queryTagItems(db *sql.DB, order string, userID int64, name string, afterID int64) ([]publishedItem, error) {
+	rows, err := db.Query(fmt.Sprintf(tagItemsQuery, order), userID, name, afterID, tagFeedLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []publishedItem
+	for rows.Next() {
+		var it publishedItem
+		err = rows.Scan(&it.ID, &it.FeedTitle, &it.Title, &it.Link, &it.Published, &it.Updated, &it.Author, &it.Body)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// subscriptionTags returns the tags of all subscriptions of a user by feed
+// ID.
+func subscriptionTags(db *sql.DB, userID int64) (map[int64][]tagView, error) {
+	rows, err := db.Query(`
+SELECT s.feed_id, t.name
+  FROM subscription s
+  JOIN subscription_tag st ON st.subscription_id = s.id
+  JOIN tag t ON t.id = st.tag_id
+ WHERE s.user_id = ?
+ ORDER BY t.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make(map[int64][]tagView)
+	for rows.Next() {
+		var feedID int64
+		var name string
+		err = rows.Scan(&feedID, &name)
+		if err != nil {
+			return nil, err
+		}
+		tags[feedID] = append(tags[feedID], newTagView(name))
+	}
+	return tags, rows.Err()
+}
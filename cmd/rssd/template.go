@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"html/template"
 	"net/http"
 
@@ -10,26 +11,44 @@ import (
 var templates map[string]*template.Template
 
 func render(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	renderStatus(w, r, http.StatusOK, tmpl, data)
+}
+
+// renderStatus renders a template with the given HTTP status code, e.g. a
+// form with validation errors. The page is rendered into a buffer first, so
+// a failing template still results in a clean internal server error.
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, tmpl string, data interface{}) {
 	t, ok := templates[tmpl]
 	if !ok {
 		log.WithField("template", tmpl).Error("template does not exist")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	err := t.Execute(w, data)
+	buf := &bytes.Buffer{}
+	err := t.Execute(buf, data)
 	if err != nil {
 		log.WithField("template", tmpl).WithError(err).Error("rendering template")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
 }
 
 // parseTemplates returns a map of parsed templates with template names for keys.
 func parseTemplates() (map[string]*template.Template, error) {
 	// template name to required template files
 	paths := map[string][]string{
-		"index.html": {"template/base.html", "template/index.html"},
+		"index.html":     {"template/base.html", "template/index.html"},
+		"item.html":      {"template/base.html", "template/item.html"},
+		"feeds.html":     {"template/base.html", "template/feeds.html"},
+		"subscribe.html": {"template/base.html", "template/subscribe.html"},
+		"rules.html":     {"template/base.html", "template/rules.html"},
+		"scrape.html":    {"template/base.html", "template/scrape.html"},
+		"monitor.html":   {"template/base.html", "template/monitor.html"},
+		"json.html":      {"template/base.html", "template/json.html"},
+		"mail.html":      {"template/base.html", "template/mail.html"},
 	}
 	tmpl := make(map[string]*template.Template, len(paths))
 	var err error
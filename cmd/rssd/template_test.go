@@ -0,0 +1,41 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderStatus(t *testing.T) {
+	saved := templates
+	defer func() { templates = saved }()
+	templates = map[string]*template.Template{
+		"form.html": template.Must(template.New("form.html").Parse(`<p>{{.Error}}</p>`)),
+		// fails half way through, after some output
+		"broken.html": template.Must(template.New("broken.html").Parse(`<p>partial</p>{{.Missing}}`)),
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	w := httptest.NewRecorder()
+	renderStatus(w, r, http.StatusBadRequest, "form.html", struct{ Error string }{"invalid URL"})
+	if w.Code != http.StatusBadRequest || w.Body.String() != "<p>invalid URL</p>" {
+		t.Errorf("got %d %q, want 400 with the form", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	w = httptest.NewRecorder()
+	renderStatus(w, r, http.StatusBadRequest, "broken.html", struct{}{})
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("got %d %q for a failing template, want a clean 500", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	render(w, r, "missing.html", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d for a missing template, want 500", w.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+type contextKey string
+
+const userKey = contextKey("user")
+
+// ensureUser returns the id of the user with the given email, creating the
+// user if necessary.
+func ensureUser(db *sql.DB, email string) (int64, error) {
+	_, err := db.Exec(`INSERT OR IGNORE INTO user (email) VALUES (?)`, email)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = db.QueryRow(`SELECT id FROM user WHERE email = ?`, email).Scan(&id)
+	return id, err
+}
+
+// withUser is a middleware that makes every request act as the given user.
+func withUser(id int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), userKey, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// userID returns the id of the user making the request.
+func userID(r *http.Request) int64 {
+	id, _ := r.Context().Value(userKey).(int64)
+	return id
+}
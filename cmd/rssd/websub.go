@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-chi/chi"
+	"github.com/nochso/rss/feed"
+)
+
+const (
+	// websubLease is the lease requested from hubs. Hubs may grant less.
+	websubLease = 7 * 24 * time.Hour
+	// websubRetry is the time after which unanswered or failed subscription
+	// requests are sent again.
+	websubRetry = time.Hour
+	// maxPushSize is the maximum size of a document pushed by a hub.
+	maxPushSize = 10 << 20
+)
+
+// subscriber manages WebSub subscriptions of feeds that advertise a hub, so
+// that new items are pushed instead of polled.
+//
+// See https://www.w3.org/TR/websub/
+type subscriber struct {
+	db     *sql.DB
+	client *http.Client
+	base   *url.URL // public URL of rssd used for callbacks
+}
+
+// newSubscriber returns a subscriber using baseURL, the public URL of rssd,
+// for callbacks.
+func newSubscriber(db *sql.DB, client *http.Client, baseURL string) (*subscriber, error) {
+	if !feed.IsHTTP(baseURL) {
+		return nil, fmt.Errorf("base URL must be a http or https URL: %q", baseURL)
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return &subscriber{db: db, client: client, base: base}, nil
+}
+
+// callback returns the URL hubs deliver updates of a feed to.
+func (s *subscriber) callback(feedID int64) string {
+	return s.base.ResolveReference(&url.URL{Path: "websub/" + strconv.FormatInt(feedID, 10)}).String()
+}
+
+// update subscribes a feed to its hub unless it already is. hub is empty if
+// the feed no longer advertises one, in which case the subscription is
+// cancelled.
+func (s *subscriber) update(ctx context.Context, l *log.Entry, feedID int64, hub, topic string, now time.Time) {
+	var oldHub, oldTopic string
+	err := s.db.QueryRow(`SELECT hub, topic FROM websub WHERE feed_id = ?`, feedID).Scan(&oldHub, &oldTopic)
+	if err != nil && err != sql.ErrNoRows {
+		l.WithError(err).Error("selecting WebSub subscription")
+		return
+	}
+	exists := err == nil
+	if hub != "" && !feed.IsHTTP(hub) {
+		l.WithField("hub", hub).Debug("ignoring WebSub hub without http URL")
+		hub = ""
+	}
+	switch {
+	case hub == "" && exists:
+		s.unsubscribe(ctx, l, feedID, oldHub, oldTopic)
+	case hub == "":
+	case !exists || hub != oldHub || topic != oldTopic:
+		s.subscribe(ctx, l, feedID, hub, topic, now)
+	}
+}
+
+// renewDue sends subscription requests that are due: leases about to expire
+// and earlier requests that failed or were never verified.
+func (s *subscriber) renewDue(ctx context.Context, now time.Time) {
+	rows, err := s.db.Query(`
+SELECT w.feed_id, w.hub, w.topic
+  FROM websub w
+  JOIN feed f ON f.id = w.feed_id
+ WHERE w.renew_at <= ?
+   AND f.disabled = 0`, now)
+	if err != nil {
+		log.WithError(err).Error("selecting due WebSub subscriptions")
+		return
+	}
+	type due struct {
+		feedID     int64
+		hub, topic string
+	}
+	var subs []due
+	for rows.Next() {
+		var d due
+		err = rows.Scan(&d.feedID, &d.hub, &d.topic)
+		if err != nil {
+			break
+		}
+		subs = append(subs, d)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		log.WithError(err).Error("selecting due WebSub subscriptions")
+		return
+	}
+	for _, d := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		l := log.WithField("feed_id", d.feedID)
+		s.subscribe(ctx, l, d.feedID, d.hub, d.topic, now)
+	}
+}
+
+// subscribe asks hub to push updates of topic. The subscription becomes
+// active once the hub verifies it by calling the callback.
+//
+// The secret is kept when renewing a subscription, so pushes signed by the
+// hub before it verified the renewal stay valid.
+func (s *subscriber) subscribe(ctx context.Context, l *log.Entry, feedID int64, hub, topic string, now time.Time) {
+	l = l.WithField("hub", hub).WithField("topic", topic)
+	secret, err := newSecret()
+	if err != nil {
+		l.WithError(err).Error("creating WebSub secret")
+		return
+	}
+	_, err = s.db.Exec(`
+INSERT INTO websub (feed_id, hub, topic, secret, requested_at, renew_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+    ON CONFLICT (feed_id) DO UPDATE
+   SET secret = CASE
+                WHEN hub = excluded.hub AND topic = excluded.topic THEN secret
+                ELSE excluded.secret
+                END,
+       lease_expires = CASE
+                       WHEN hub = excluded.hub AND topic = excluded.topic THEN lease_expires
+                       ELSE NULL
+                       END,
+       hub = excluded.hub,
+       topic = excluded.topic,
+       requested_at = excluded.requested_at,
+       renew_at = excluded.renew_at`,
+		feedID,
+		hub,
+		topic,
+		secret,
+		now,
+		now.Add(websubRetry),
+	)
+	if err == nil {
+		err = s.db.QueryRow(`SELECT secret FROM websub WHERE feed_id = ?`, feedID).Scan(&secret)
+	}
+	if err != nil {
+		l.WithError(err).Error("storing WebSub subscription")
+		return
+	}
+	err = s.request(ctx, hub, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {s.callback(feedID)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(int(websubLease.Seconds()))},
+	})
+	if err != nil {
+		l.WithError(err).Warn("requesting WebSub subscription")
+		return
+	}
+	l.Info("requested WebSub subscription")
+}
+
+// unsubscribe removes a subscription and asks the hub to stop pushing.
+func (s *subscriber) unsubscribe(ctx context.Context, l *log.Entry, feedID int64, hub, topic string) {
+	l = l.WithField("hub", hub).WithField("topic", topic)
+	_, err := s.db.Exec(`DELETE FROM websub WHERE feed_id = ?`, feedID)
+	if err != nil {
+		l.WithError(err).Error("deleting WebSub subscription")
+		return
+	}
+	err = s.request(ctx, hub, url.Values{
+		"hub.mode":     {"unsubscribe"},
+		"hub.topic":    {topic},
+		"hub.callback": {s.callback(feedID)},
+	})
+	if err != nil {
+		// the lease will expire eventually and pushes are rejected meanwhile
+		l.WithError(err).Warn("requesting WebSub unsubscription")
+		return
+	}
+	l.Info("requested WebSub unsubscription")
+}
+
+// request sends a subscription request to a hub.
+func (s *subscriber) request(ctx context.Context, hub string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected HTTP status: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleWebSubVerify answers the intent verification of hubs. Subscriptions
+// are confirmed only for the topic that was requested and unsubscriptions
+// only if the subscription was removed.
+func handleWebSubVerify(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		mode, topic := q.Get("hub.mode"), q.Get("hub.topic")
+		l := log.WithField("feed_id", id).WithField("mode", mode).WithField("topic", topic)
+		var found bool
+		err = db.QueryRow(`SELECT COUNT(*) > 0 FROM websub WHERE feed_id = ? AND topic = ?`, id, topic).Scan(&found)
+		if err != nil {
+			l.WithError(err).Error("selecting WebSub subscription")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now().UTC()
+		switch mode {
+		case "subscribe":
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			lease := websubLease
+			if s, err := strconv.Atoi(q.Get("hub.lease_seconds")); err == nil && s > 0 {
+				lease = time.Duration(s) * time.Second
+			}
+			_, err = db.Exec(
+				`UPDATE websub SET lease_expires = ?, renew_at = ? WHERE feed_id = ?`,
+				now.Add(lease),
+				now.Add(lease*9/10),
+				id,
+			)
+			if err != nil {
+				l.WithError(err).Error("activating WebSub subscription")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			l.WithField("lease", lease).Info("WebSub subscription verified")
+		case "unsubscribe":
+			if found {
+				http.NotFound(w, r)
+				return
+			}
+		case "denied":
+			if found {
+				// ask again much later instead of after every fetch
+				_, err = db.Exec(
+					`UPDATE websub SET lease_expires = NULL, renew_at = ? WHERE feed_id = ?`,
+					now.Add(websubLease),
+					id,
+				)
+				if err != nil {
+					l.WithError(err).Error("recording denied WebSub subscription")
+				}
+			}
+			l.WithField("reason", q.Get("hub.reason")).Warn("WebSub subscription denied")
+			w.WriteHeader(http.StatusOK)
+			return
+		default:
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, q.Get("hub.challenge"))
+	}
+}
+
+// handleWebSubPush stores the items of a document pushed by a hub. Pushes
+// without a valid signature are acknowledged but ignored, as required by
+// WebSub.
+func handleWebSubPush(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		l := log.WithField("feed_id", id)
+		var secret, topic string
+		err = db.QueryRow(`SELECT secret, topic FROM websub WHERE feed_id = ?`, id).Scan(&secret, &topic)
+		if err == sql.ErrNoRows {
+			// tells the hub to stop pushing
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		}
+		if err != nil {
+			l.WithError(err).Error("selecting WebSub subscription")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPushSize+1))
+		if err != nil {
+			l.WithError(err).Warn("reading WebSub push")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxPushSize {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validSignature(r.Header.Get("X-Hub-Signature"), secret, body) {
+			l.Warn("ignoring WebSub push with invalid signature")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		base, _ := url.Parse(topic)
+		doc, err := feed.Parse(bytes.NewReader(body), r.Header.Get("Content-Type"), base)
+		if err != nil {
+			l.WithError(err).Warn("parsing WebSub push")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		err = storePushed(db, id, doc, time.Now().UTC())
+		if err != nil {
+			l.WithError(err).Error("storing WebSub push")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		l.WithField("items", len(doc.Items)).Debug("WebSub push stored")
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// signatureHashes are the hash functions hubs may sign pushes with.
+var signatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// validSignature checks a X-Hub-Signature header of the form method=hex.
+func validSignature(header, secret string, body []byte) bool {
+	i := strings.IndexByte(header, '=')
+	if i < 0 {
+		return false
+	}
+	h, ok := signatureHashes[strings.ToLower(header[:i])]
+	if !ok {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(header[i+1:]))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// pushLinks returns the hub and topic of a feed. The topic is the self URL
+// the hub knows the feed by, which may differ from the URL it was fetched
+// from.
+func pushLinks(link string, cache httpCache, doc *feed.Feed) (hub, topic string) {
+	hub, topic = cache.hub, cache.self
+	if hub == "" {
+		hub = doc.Hub
+	}
+	if topic == "" {
+		topic = doc.Self
+	}
+	if topic == "" {
+		topic = link
+	}
+	return hub, topic
+}
+
+// parseLinkHeader returns the hub and self URLs of Link headers, which take
+// precedence over links in the document.
+func parseLinkHeader(values []string, base *url.URL) (hub, self string) {
+	for _, v := range values {
+		for v != "" {
+			start := strings.IndexByte(v, '<')
+			end := strings.IndexByte(v, '>')
+			if start < 0 || end < start {
+				break
+			}
+			link := strings.TrimSpace(v[start+1 : end])
+			v = v[end+1:]
+			params := v
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				params, v = v[:i], v[i+1:]
+			} else {
+				v = ""
+			}
+			for _, p := range strings.Split(params, ";") {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					switch {
+					case strings.EqualFold(rel, "hub") && hub == "":
+						hub = resolveLink(base, link)
+					case strings.EqualFold(rel, "self") && self == "":
+						self = resolveLink(base, link)
+					}
+				}
+			}
+		}
+	}
+	return hub, self
+}
+
+func resolveLink(base *url.URL, link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return u.String()
+}
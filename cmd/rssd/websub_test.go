@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const testPushRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+<title>Pushed</title><link>http://example.com/</link>
+<atom:link rel="hub" href="%s"/>
+<atom:link rel="self" href="%s"/>
+<item><title>%s</title><guid>%[3]s</guid></item>
+</channel></rss>`
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebSub(t *testing.T) {
+	db := testDB(t)
+
+	// the hub records subscription requests, verification is up to the test
+	requests := make(chan url.Values, 10)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		requests <- r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+	var topic string
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testPushRSS, hub.URL, topic, "polled")
+	}))
+	defer publisher.Close()
+	topic = publisher.URL + "/feed.xml"
+	router := chi.NewRouter()
+	router.Get("/websub/{id}", handleWebSubVerify(db))
+	router.Post("/websub/{id}", handleWebSubPush(db))
+	rssd := httptest.NewServer(router)
+	defer rssd.Close()
+
+	f := newFetcher(db)
+	f.client = publisher.Client()
+	var err error
+	f.websub, err = newSubscriber(db, f.client, rssd.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedID := subscribeTestFeed(t, db, topic)
+	callback := fmt.Sprintf("%s/websub/%d", rssd.URL, feedID)
+
+	// subscribe after the first fetch
+	fetchFeed(t, f, feedID)
+	var req url.Values
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("no subscription request after fetch")
+	}
+	secret := req.Get("hub.secret")
+	if req.Get("hub.mode") != "subscribe" || req.Get("hub.topic") != topic || req.Get("hub.callback") != callback || secret == "" {
+		t.Fatalf("subscription request %v", req)
+	}
+	fetchFeed(t, f, feedID)
+	if len(requests) != 0 {
+		t.Errorf("subscription requested again by second fetch: %v", <-requests)
+	}
+
+	// intent verification
+	verify := func(mode, topic string) (int, string) {
+		q := url.Values{
+			"hub.mode":          {mode},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"challenge-" + mode},
+			"hub.lease_seconds": {"3600"},
+		}
+		resp, err := http.Get(callback + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if status, _ := verify("subscribe", topic+"?other"); status != http.StatusNotFound {
+		t.Errorf("verification of other topic: %d, want 404", status)
+	}
+	if status, _ := verify("unsubscribe", topic); status != http.StatusNotFound {
+		t.Errorf("verification of unrequested unsubscription: %d, want 404", status)
+	}
+	start := time.Now().UTC()
+	if status, body := verify("subscribe", topic); status != http.StatusOK || body != "challenge-subscribe" {
+		t.Fatalf("verification: %d %q, want the challenge", status, body)
+	}
+	var leaseExpires, renewAt time.Time
+	err = db.QueryRow(`SELECT lease_expires, renew_at FROM websub WHERE feed_id = ?`, feedID).Scan(&leaseExpires, &renewAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := leaseExpires.Sub(start); d < time.Hour-time.Minute || d > time.Hour+time.Minute {
+		t.Errorf("lease expires in %v, want an hour", d)
+	}
+	if !renewAt.Before(leaseExpires) || !renewAt.After(start) {
+		t.Errorf("renewal at %v for lease expiring at %v", renewAt, leaseExpires)
+	}
+
+	// pushes must be signed with the secret
+	push := func(title, signature string) int {
+		body := fmt.Sprintf(testPushRSS, hub.URL, topic, title)
+		r, err := http.NewRequest(http.MethodPost, callback, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/rss+xml")
+		if signature == "" {
+			signature = sign(secret, body)
+		}
+		r.Header.Set("X-Hub-Signature", signature)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	hasItem := func(title string) bool {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM feed_item WHERE feed_id = ? AND title = ?`, feedID, title).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n > 0
+	}
+	if status := push("signed", ""); status != http.StatusAccepted || !hasItem("signed") {
+		t.Errorf("signed push: %d, stored %v", status, hasItem("signed"))
+	}
+	if status := push("forged", sign("wrong secret", "forged")); status != http.StatusAccepted || hasItem("forged") {
+		t.Errorf("push with bad signature: %d, stored %v", status, hasItem("forged"))
+	}
+	if status := push("unsigned", "sha256=zz"); status != http.StatusAccepted || hasItem("unsigned") {
+		t.Errorf("push with malformed signature: %d, stored %v", status, hasItem("unsigned"))
+	}
+
+	// the lease is renewed before it expires, keeping the secret
+	f.websub.renewDue(context.Background(), start.Add(time.Minute))
+	if len(requests) != 0 {
+		t.Fatalf("renewed long before the lease expires: %v", <-requests)
+	}
+	f.websub.renewDue(context.Background(), renewAt.Add(time.Second))
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("lease was not renewed")
+	}
+	if req.Get("hub.mode") != "subscribe" || req.Get("hub.topic") != topic || req.Get("hub.secret") != secret {
+		t.Errorf("renewal request %v, want the same topic and secret", req)
+	}
+
+	// unknown subscriptions tell the hub to stop
+	r, err := http.Post(fmt.Sprintf("%s/websub/%d", rssd.URL, feedID+1), "application/rss+xml", strings.NewReader("<rss/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusGone {
+		t.Errorf("push for unknown subscription: %d, want 410", r.StatusCode)
+	}
+}
@@ -0,0 +1,237 @@
+// Package discover finds the feeds of a website.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nochso/rss/feed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// maxBodySize limits how much of a page is read.
+const maxBodySize = 10 << 20
+
+// feedTypes are MIME types of alternate links that point to feeds.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// commonPaths are probed if a page does not link to any feeds.
+var commonPaths = []string{
+	"/feed",
+	"/rss",
+	"/feed.xml",
+	"/rss.xml",
+	"/atom.xml",
+	"/index.xml",
+	"/feed.json",
+}
+
+// Feed is a candidate found on a website.
+type Feed struct {
+	URL   string
+	Title string
+}
+
+// Finder discovers feeds using HTTP.
+type Finder struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+// Find returns the feeds of a website.
+//
+// If rawurl points to a feed, only that feed is returned. Otherwise the page
+// is searched for alternate links. If there are none, common feed locations
+// of the site are probed.
+func (f *Finder) Find(ctx context.Context, rawurl string) ([]Feed, error) {
+	if !strings.Contains(rawurl, "://") {
+		// users often omit the scheme
+		rawurl = "http://" + rawurl
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	p, err := f.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err := feed.Parse(bytes.NewReader(p.body), p.contentType, p.url); err == nil {
+		return []Feed{{URL: p.url.String(), Title: doc.Title}}, nil
+	}
+	r, err := charset.NewReader(bytes.NewReader(p.body), p.contentType)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := parseLinks(r, p.url)
+	if err != nil {
+		return nil, err
+	}
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+	return f.probe(ctx, p.url), nil
+}
+
+// probe tries common feed locations relative to the root of the site.
+func (f *Finder) probe(ctx context.Context, site *url.URL) []Feed {
+	var feeds []Feed
+	for _, p := range commonPaths {
+		if ctx.Err() != nil {
+			break
+		}
+		u := site.ResolveReference(&url.URL{Path: p})
+		p, err := f.get(ctx, u)
+		if err != nil {
+			continue
+		}
+		doc, err := feed.Parse(bytes.NewReader(p.body), p.contentType, p.url)
+		if err != nil {
+			continue
+		}
+		feeds = appendFeed(feeds, Feed{URL: p.url.String(), Title: doc.Title})
+	}
+	return feeds
+}
+
+// page is the response to a successful GET request.
+type page struct {
+	body        []byte
+	url         *url.URL // final URL after redirects
+	contentType string
+}
+
+// get returns the page of a successful GET request.
+func (f *Finder) get(ctx context.Context, u *url.URL) (*page, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	return &page{
+		body:        body,
+		url:         resp.Request.URL,
+		contentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// parseLinks returns feeds linked by <link rel="alternate"> elements of a HTML
+// page. Feeds without title are named after the page.
+func parseLinks(r io.Reader, base *url.URL) ([]Feed, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var feeds []Feed
+	var pageTitle string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Base:
+				if href := attr(n, "href"); href != "" {
+					if u, err := base.Parse(href); err == nil {
+						base = u
+					}
+				}
+			case atom.Title:
+				if pageTitle == "" && n.FirstChild != nil {
+					pageTitle = strings.TrimSpace(n.FirstChild.Data)
+				}
+			case atom.Link:
+				if !hasToken(attr(n, "rel"), "alternate") {
+					break
+				}
+				typ := strings.ToLower(strings.TrimSpace(attr(n, "type")))
+				if i := strings.IndexByte(typ, ';'); i >= 0 {
+					typ = strings.TrimSpace(typ[:i])
+				}
+				href := strings.TrimSpace(attr(n, "href"))
+				if !feedTypes[typ] || href == "" {
+					break
+				}
+				u, err := base.Parse(href)
+				if err != nil {
+					break
+				}
+				feeds = appendFeed(feeds, Feed{
+					URL:   u.String(),
+					Title: strings.TrimSpace(attr(n, "title")),
+				})
+			case atom.Body:
+				// alternate links belong into the head
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	for i := range feeds {
+		if feeds[i].Title == "" {
+			feeds[i].Title = pageTitle
+		}
+	}
+	return feeds, nil
+}
+
+// appendFeed appends f unless a feed with the same URL exists.
+func appendFeed(feeds []Feed, f Feed) []Feed {
+	for _, existing := range feeds {
+		if existing.URL == f.URL {
+			return feeds
+		}
+	}
+	return append(feeds, f)
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken returns true if the space separated list contains token.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
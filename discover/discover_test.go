@@ -0,0 +1,114 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>%s</title><link>http://example.com/</link></channel></rss>`
+
+func testServer(pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(body, "<?xml") {
+			w.Header().Set("Content-Type", "application/rss+xml")
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestFind(t *testing.T) {
+	pages := map[string]string{
+		"/blog/": `<!DOCTYPE html><html><head>
+<title>Blog</title>
+<link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml">
+<link rel="Alternate" type="application/atom+xml; charset=utf-8" href="/atom.xml">
+<link rel="alternate" type="application/feed+json" href="https://example.org/feed.json">
+<link rel="alternate" type="application/json" href="/wp-json/wp/v2/posts/1">
+<link rel="alternate" type="text/html" hreflang="de" href="/de/">
+<link rel="alternate stylesheet" type="text/css" href="/dark.css">
+<link rel="stylesheet" type="application/rss+xml" href="/not-alternate.xml">
+<link rel="alternate" type="application/rss+xml" href="">
+<link rel="alternate" type="application/rss+xml" title="Duplicate" href="/blog/feed.xml">
+</head><body>
+<link rel="alternate" type="application/rss+xml" href="/body.xml">
+</body></html>`,
+		"/based/":   `<html><head><base href="/other/"><link rel="alternate" type="application/rss+xml" href="feed.xml"></head></html>`,
+		"/feed.xml": fmt.Sprintf(testRSS, "Probed"),
+		"/rss.xml":  `<html>not a feed</html>`,
+		"/direct":   fmt.Sprintf(testRSS, "Direct"),
+		"/empty":    `<html><head><title>Empty</title></head></html>`,
+	}
+	srv := testServer(pages)
+	defer srv.Close()
+	tests := []struct {
+		name string
+		url  string
+		want []Feed
+	}{
+		{"links", srv.URL + "/blog/", []Feed{
+			{URL: srv.URL + "/blog/feed.xml", Title: "Posts"},
+			{URL: srv.URL + "/atom.xml", Title: "Blog"},
+			{URL: "https://example.org/feed.json", Title: "Blog"},
+		}},
+		{"base element", srv.URL + "/based/", []Feed{{URL: srv.URL + "/other/feed.xml"}}},
+		{"feed", srv.URL + "/direct", []Feed{{URL: srv.URL + "/direct", Title: "Direct"}}},
+		{"probed", srv.URL + "/empty", []Feed{{URL: srv.URL + "/feed.xml", Title: "Probed"}}},
+		{"without scheme", strings.TrimPrefix(srv.URL, "http://") + "/direct", []Feed{{URL: srv.URL + "/direct", Title: "Direct"}}},
+	}
+	f := &Finder{Client: srv.Client()}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := f.Find(context.Background(), test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindErrors(t *testing.T) {
+	srv := testServer(nil)
+	defer srv.Close()
+	f := &Finder{Client: srv.Client()}
+	for _, u := range []string{"ftp://example.com/", srv.URL + "/missing"} {
+		if feeds, err := f.Find(context.Background(), u); err == nil {
+			t.Errorf("Find(%q) = %v, want error", u, feeds)
+		}
+	}
+}
+
+func TestFindBodySize(t *testing.T) {
+	link := `<link rel="alternate" type="application/rss+xml" href="/feed.xml">`
+	pages := map[string]string{
+		"/small": `<html><head><!--` + strings.Repeat(" ", maxBodySize-100) + `-->` + link + `</head></html>`,
+		"/large": `<html><head><!--` + strings.Repeat(" ", maxBodySize) + `-->` + link + `</head></html>`,
+	}
+	srv := testServer(pages)
+	defer srv.Close()
+	f := &Finder{Client: srv.Client()}
+	feeds, err := f.Find(context.Background(), srv.URL+"/small")
+	if err != nil || len(feeds) != 1 {
+		t.Errorf("link before size limit: %v %v", feeds, err)
+	}
+	// the link is cut off and /feed.xml is not probed as it is missing
+	feeds, err = f.Find(context.Background(), srv.URL+"/large")
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("link after size limit: %v %v", feeds, err)
+	}
+}
@@ -0,0 +1,314 @@
+// Package extract finds the main article of a web page, similar to the
+// readability bookmarklet.
+//
+// Paragraphs are scored by the amount of text and commas. Their scores are
+// added to their parent and grandparent. The element with the highest score,
+// penalized by its density of links, is the article. Siblings that look like
+// part of the article are included as well.
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNotFound is returned if a page contains no recognizable article.
+var ErrNotFound = errors.New("no article found")
+
+// minLength is the minimum amount of text an article must have.
+const minLength = 250
+
+var (
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|nav|popup|promo|related|remark|rss|share|shoutbox|sidebar|social|sponsor|subscribe|ad-break|agegate|pagination|pager`)
+	maybe    = regexp.MustCompile(`(?i)and|article|body|column|main|shadow|content`)
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removed elements never contain article text.
+var removed = map[atom.Atom]bool{
+	atom.Aside:    true,
+	atom.Button:   true,
+	atom.Footer:   true,
+	atom.Form:     true,
+	atom.Head:     true,
+	atom.Header:   true,
+	atom.Input:    true,
+	atom.Nav:      true,
+	atom.Noscript: true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Textarea: true,
+}
+
+// scored elements contribute their text to the score of their ancestors.
+var scored = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.Td:         true,
+	atom.Blockquote: true,
+}
+
+// Article returns the HTML of the main article of the page read from r.
+// The page must be UTF-8. base is the URL of the page and used to resolve
+// links of the article; it may be nil.
+//
+// The result is not sanitized.
+func Article(r io.Reader, base *url.URL) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	body := find(doc, atom.Body)
+	if body == nil {
+		return "", ErrNotFound
+	}
+	prune(body)
+	scores := make(map[*html.Node]float64)
+	score(body, scores)
+
+	// candidates are visited in document order so ties go to the first
+	var best *html.Node
+	bestScore := 0.0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if s, ok := scores[n]; ok {
+			s *= 1 - linkDensity(n)
+			scores[n] = s
+			if best == nil || s > bestScore {
+				best, bestScore = n, s
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+	if best == nil {
+		return "", ErrNotFound
+	}
+
+	article := collect(best, bestScore, scores)
+	if len(strings.TrimSpace(textOf(article...))) < minLength {
+		return "", ErrNotFound
+	}
+	buf := &bytes.Buffer{}
+	for _, n := range article {
+		resolve(n, base)
+		err = html.Render(buf, n)
+		if err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// prune removes elements that are unlikely to be part of the article.
+func prune(n *html.Node) {
+	c := n.FirstChild
+	for c != nil {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case removed[c.DataAtom], isUnlikely(c):
+			n.RemoveChild(c)
+		default:
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	s := attr(n, "class") + " " + attr(n, "id")
+	return unlikely.MatchString(s) && !maybe.MatchString(s)
+}
+
+// score walks the tree and adds the score of each paragraph to its parent
+// and half of it to its grandparent.
+func score(n *html.Node, scores map[*html.Node]float64) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if scored[c.DataAtom] {
+			text := strings.TrimSpace(textOf(c))
+			if len(text) >= 25 {
+				s := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+				if p := c.Parent; p != nil && p.Type == html.ElementNode {
+					addScore(p, s, scores)
+					if gp := p.Parent; gp != nil && gp.Type == html.ElementNode {
+						addScore(gp, s/2, scores)
+					}
+				}
+			}
+		}
+		score(c, scores)
+	}
+}
+
+// addScore initializes a candidate with a score based on its element and
+// class and adds s.
+func addScore(n *html.Node, s float64, scores map[*html.Node]float64) {
+	if _, ok := scores[n]; !ok {
+		scores[n] = baseScore(n)
+	}
+	scores[n] += s
+}
+
+func baseScore(n *html.Node) float64 {
+	s := 0.0
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		s += 10
+	case atom.Div:
+		s += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s -= 5
+	}
+	for _, v := range []string{attr(n, "class"), attr(n, "id")} {
+		if v == "" {
+			continue
+		}
+		if negative.MatchString(v) {
+			s -= 25
+		}
+		if positive.MatchString(v) {
+			s += 25
+		}
+	}
+	return s
+}
+
+// collect returns the best candidate and those of its siblings that are
+// likely part of the article too.
+func collect(best *html.Node, bestScore float64, scores map[*html.Node]float64) []*html.Node {
+	if best.Parent == nil {
+		return []*html.Node{best}
+	}
+	threshold := math.Max(10, bestScore*0.2)
+	var nodes []*html.Node
+	for s := best.Parent.FirstChild; s != nil; s = s.NextSibling {
+		switch {
+		case s == best:
+		case s.Type != html.ElementNode:
+			continue
+		case scores[s] >= threshold:
+		case s.DataAtom == atom.P:
+			text := textOf(s)
+			density := linkDensity(s)
+			if !(len(text) > 80 && density < 0.25) &&
+				!(len(text) > 0 && density == 0 && strings.Contains(text, ". ")) {
+				continue
+			}
+		default:
+			continue
+		}
+		nodes = append(nodes, s)
+	}
+	// detach so the article can be rendered on its own
+	for _, n := range nodes {
+		n.Parent.RemoveChild(n)
+	}
+	return nodes
+}
+
+// linkDensity returns the ratio of link text to all text of n.
+func linkDensity(n *html.Node) float64 {
+	total := len(textOf(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.A {
+				links += len(textOf(c))
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(links) / float64(total)
+}
+
+// resolve makes links and image sources of n absolute.
+func resolve(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			u, err := base.Parse(strings.TrimSpace(a.Val))
+			if err == nil {
+				n.Attr[i].Val = u.String()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolve(c, base)
+	}
+}
+
+// textOf returns the text content of the given nodes.
+func textOf(nodes ...*html.Node) string {
+	buf := &bytes.Buffer{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return buf.String()
+}
+
+// find returns the first element of type a in depth-first order.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f := find(c, a); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package extract
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func articleOf(t *testing.T, name, base string) (string, error) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var u *url.URL
+	if base != "" {
+		u, err = url.Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Article(f, u)
+}
+
+func TestArticle(t *testing.T) {
+	tests := []struct {
+		file    string
+		base    string
+		want    []string // substrings of the article
+		notWant []string
+	}{
+		{
+			file: "article.html",
+			base: "http://example.com/posts/reader",
+			want: []string{
+				"Feed readers have been around for a long time",
+				"A readability algorithm has to find the main content.",
+				`<a href="http://example.com/posts/scoring">the scoring post</a>`,
+				`<img src="http://example.com/posts/images/diagram.png"`,
+			},
+			notWant: []string{
+				"Archive",
+				"tracking",
+				"Great post",
+				"newsletter",
+				"Copyright",
+			},
+		},
+		{
+			file:    "article.html",
+			want:    []string{`<a href="/posts/scoring">`, `<img src="images/diagram.png"`},
+			notWant: []string{"http://"},
+		},
+		{
+			// both candidates score the same, the first one wins
+			file:    "tie.html",
+			want:    []string{`<div id="first">`, "alpha"},
+			notWant: []string{"omega"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := articleOf(t, tt.file, tt.base)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: article does not contain %q:\n%s", tt.file, s, got)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: article contains %q:\n%s", tt.file, s, got)
+			}
+		}
+	}
+}
+
+func TestArticleTieIsStable(t *testing.T) {
+	first, err := articleOf(t, "tie.html", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// map iteration order is random, so a few runs would catch it
+	for i := 0; i < 20; i++ {
+		got, err := articleOf(t, "tie.html", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != first {
+			t.Fatalf("run %d returned a different article:\n%s\nwant:\n%s", i, got, first)
+		}
+	}
+}
+
+func TestArticleNotFound(t *testing.T) {
+	for _, file := range []string{"short.html"} {
+		_, err := articleOf(t, file, "")
+		if err != ErrNotFound {
+			t.Errorf("%s: error = %v, want %v", file, err, ErrNotFound)
+		}
+	}
+	_, err := Article(strings.NewReader(""), nil)
+	if err != ErrNotFound {
+		t.Errorf("empty page: error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestByRule(t *testing.T) {
+	base, _ := url.Parse("http://example.com/stories/story")
+	f, err := os.Open(filepath.Join("testdata", "paged.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, next, err := ByRule(f, base, Rule{
+		Content:  ".story .text",
+		Remove:   ".ad",
+		NextPage: "a.next",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"The first page of a multi-page story.",
+		"A second block of the same page.",
+		`<a href="http://example.com/glossary">Glossary</a>`,
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("article does not contain %q:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"Buy now!", "Part one", "Next page"} {
+		if strings.Contains(got, s) {
+			t.Errorf("article contains %q:\n%s", s, got)
+		}
+	}
+	if want := "http://example.com/stories/story?page=2"; next != want {
+		t.Errorf("next page = %q, want %q", next, want)
+	}
+
+	_, _, err = ByRule(strings.NewReader("<p>nothing</p>"), nil, Rule{Content: "article"})
+	if err != ErrNotFound {
+		t.Errorf("unmatched content selector: error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Content: "article"}, true},
+		{Rule{Content: "article", Remove: ".ad, .share", NextPage: "a[rel=next]"}, true},
+		{Rule{}, false},
+		{Rule{Content: "  "}, false},
+		{Rule{Content: "article["}, false},
+		{Rule{Content: "article", Remove: "::"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%+v: error = %v, want ok = %v", tt.rule, err, tt.ok)
+		}
+	}
+}
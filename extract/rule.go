@@ -0,0 +1,139 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Rule selects the article of a specific site using CSS selectors, for sites
+// where the heuristics of Article fail.
+type Rule struct {
+	// Content selects the article. All matches are concatenated.
+	Content string
+	// Remove selects elements to be removed from the article, e.g. ads.
+	// Optional.
+	Remove string
+	// NextPage selects the link to the next page of a multi-page article.
+	// Optional.
+	NextPage string
+}
+
+// Validate returns an error if any of the selectors is invalid.
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.Content) == "" {
+		return fmt.Errorf("content selector is required")
+	}
+	for _, s := range []struct{ name, sel string }{
+		{"content", r.Content},
+		{"remove", r.Remove},
+		{"next page", r.NextPage},
+	} {
+		if s.sel == "" {
+			continue
+		}
+		if _, err := cascadia.ParseGroup(s.sel); err != nil {
+			return fmt.Errorf("invalid %s selector: %v", s.name, err)
+		}
+	}
+	return nil
+}
+
+// ByRule returns the HTML of the article of a single page selected by rule
+// and the absolute URL of the next page, if any. The page must be UTF-8.
+// base is the URL of the page; it may be nil.
+//
+// ErrNotFound is returned if the content selector matches nothing. The
+// result is not sanitized.
+func ByRule(r io.Reader, base *url.URL, rule Rule) (string, string, error) {
+	content, err := cascadia.ParseGroup(rule.Content)
+	if err != nil {
+		return "", "", err
+	}
+	var remove, next cascadia.Matcher
+	if rule.Remove != "" {
+		remove, err = cascadia.ParseGroup(rule.Remove)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if rule.NextPage != "" {
+		next, err = cascadia.ParseGroup(rule.NextPage)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	nextPage := ""
+	if next != nil {
+		if a := cascadia.Query(doc, next); a != nil {
+			if u, err := resolveHref(attr(a, "href"), base); err == nil {
+				nextPage = u
+			}
+		}
+	}
+
+	nodes := cascadia.QueryAll(doc, content)
+	if len(nodes) == 0 {
+		return "", "", ErrNotFound
+	}
+	buf := &bytes.Buffer{}
+	for _, n := range nodes {
+		if isInside(n, nodes) {
+			// already rendered as part of an ancestor
+			continue
+		}
+		if remove != nil {
+			for _, rm := range cascadia.QueryAll(n, remove) {
+				if rm.Parent != nil {
+					rm.Parent.RemoveChild(rm)
+				}
+			}
+		}
+		resolve(n, base)
+		err = html.Render(buf, n)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return buf.String(), nextPage, nil
+}
+
+// isInside returns true if any ancestor of n is one of nodes.
+func isInside(n *html.Node, nodes []*html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		for _, o := range nodes {
+			if p == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func resolveHref(href string, base *url.URL) (string, error) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", fmt.Errorf("no link")
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported URL %q", u)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,170 @@
+package feed
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// parseAtom maps an Atom 1.0 document to a Feed.
+//
+// Relative links are resolved using xml:base of the elements and base.
+func parseAtom(root *node, base *url.URL) (*Feed, error) {
+	if root.XMLName.Space != nsAtom {
+		return nil, errors.New("atom: unsupported namespace " + root.XMLName.Space)
+	}
+	base = xmlBase(base, root)
+	f := &Feed{
+		Title:       atomText(root.child(nsAtom, "title")),
+		Link:        atomLink(root, base),
+		Description: atomText(root.child(nsAtom, "subtitle")),
+		Language:    root.attr(nsXML, "lang"),
+	}
+	for _, l := range root.children(nsAtom, "link") {
+		switch l.attr("", "rel") {
+		case "self":
+			if f.Self == "" {
+				f.Self = resolveURL(xmlBase(base, l), strings.TrimSpace(l.attr("", "href")))
+			}
+		case "hub":
+			if f.Hub == "" {
+				f.Hub = resolveURL(xmlBase(base, l), strings.TrimSpace(l.attr("", "href")))
+			}
+		}
+	}
+	author := atomAuthor(root)
+	for _, n := range root.children(nsAtom, "entry") {
+		item := parseAtomEntry(n, base)
+		if item.Author.IsZero() {
+			item.Author = author
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+func parseAtomEntry(n *node, base *url.URL) *Item {
+	base = xmlBase(base, n)
+	item := &Item{
+		GUID:        n.text(nsAtom, "id"),
+		Title:       atomText(n.child(nsAtom, "title")),
+		Link:        atomLink(n, base),
+		Published:   ParseDate(n.text(nsAtom, "published")),
+		Updated:     ParseDate(n.text(nsAtom, "updated")),
+		Author:      atomAuthor(n),
+		Description: atomContent(n.child(nsAtom, "summary")),
+		Content:     atomContent(n.child(nsAtom, "content")),
+	}
+	for _, c := range n.children(nsAtom, "category") {
+		label := strings.TrimSpace(c.attr("", "label"))
+		if label == "" {
+			label = strings.TrimSpace(c.attr("", "term"))
+		}
+		item.Categories = appendCategory(item.Categories, label)
+	}
+	for _, l := range n.children(nsAtom, "link") {
+		if l.attr("", "rel") != "enclosure" {
+			continue
+		}
+		item.addEnclosure(&Enclosure{
+			URL:    resolveURL(xmlBase(base, l), strings.TrimSpace(l.attr("", "href"))),
+			Type:   l.attr("", "type"),
+			Length: parseInt64(l.attr("", "length")),
+			Title:  l.attr("", "title"),
+		})
+	}
+	parseMedia(n, item)
+	for _, e := range item.Enclosures {
+		e.URL = resolveURL(base, e.URL)
+	}
+	item.Image = resolveURL(base, item.Image)
+	if item.Published.IsZero() {
+		item.Published = item.Updated
+	}
+	return item
+}
+
+// atomLink returns the resolved URL of the alternate link, preferring HTML
+// over other media types.
+func atomLink(n *node, base *url.URL) string {
+	var link *node
+	for _, l := range n.children(nsAtom, "link") {
+		rel := l.attr("", "rel")
+		if rel != "" && rel != "alternate" {
+			continue
+		}
+		typ := l.attr("", "type")
+		if typ == "" || typ == "text/html" || typ == "application/xhtml+xml" {
+			link = l
+			break
+		}
+		if link == nil {
+			link = l
+		}
+	}
+	if link == nil {
+		return ""
+	}
+	return resolveURL(xmlBase(base, link), strings.TrimSpace(link.attr("", "href")))
+}
+
+// atomAuthor returns the first author.
+func atomAuthor(n *node) Person {
+	a := n.child(nsAtom, "author")
+	if a == nil {
+		return Person{}
+	}
+	return Person{
+		Name:  a.text(nsAtom, "name"),
+		Email: a.text(nsAtom, "email"),
+	}
+}
+
+// atomText returns a text construct as plain text.
+func atomText(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.attr("", "type") {
+	case "xhtml":
+		return strings.Join(strings.Fields(n.innerText()), " ")
+	case "html":
+		return strings.Join(strings.Fields(stripTags(n.Text)), " ")
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+// atomContent returns a text construct or content element as HTML.
+func atomContent(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.attr("", "type") {
+	case "xhtml":
+		// the content is wrapped in a single xhtml div
+		if div := n.child(nsXHTML, "div"); div != nil {
+			return strings.TrimSpace(div.Inner)
+		}
+		return strings.TrimSpace(n.Inner)
+	case "", "text":
+		return strings.TrimSpace(html.EscapeString(n.Text))
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+// xmlBase returns the base URL of a node, taking xml:base into account.
+func xmlBase(base *url.URL, n *node) *url.URL {
+	b := n.attr(nsXML, "base")
+	if b == "" {
+		return base
+	}
+	u, err := url.Parse(strings.TrimSpace(b))
+	if err != nil {
+		return base
+	}
+	if base == nil {
+		return u
+	}
+	return base.ResolveReference(u)
+}
@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// prologEncoding matches the encoding declaration of an XML prolog.
+var prologEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// toUTF8 transcodes a document to UTF-8.
+//
+// The encoding is determined by, in order of precedence, a byte order mark,
+// the charset parameter of contentType and the encoding declaration of an XML
+// prolog. Unknown or missing encodings default to UTF-8. As servers and
+// publishers tend to get this wrong, a document that is supposed to be UTF-8
+// but isn't valid UTF-8 is assumed to be windows-1252 instead.
+func toUTF8(data []byte, contentType string) ([]byte, error) {
+	enc := detectCharset(data, contentType)
+	if enc == nil {
+		return data, nil
+	}
+	return enc.NewDecoder().Bytes(data)
+}
+
+// detectCharset returns the encoding of data. A nil encoding means data is
+// already UTF-8 without byte order mark.
+func detectCharset(data []byte, contentType string) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return unicode.UTF8BOM
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	}
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	if label == "" {
+		head := data
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if m := prologEncoding.FindSubmatch(head); m != nil {
+			label = string(m[1])
+		}
+	}
+	enc, name := charset.Lookup(label)
+	if enc == nil || name == "utf-8" {
+		if utf8.Valid(data) {
+			return nil
+		}
+		return charmap.Windows1252
+	}
+	return enc
+}
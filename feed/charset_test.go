@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCharset(t *testing.T) {
+	tests := []struct {
+		file        string
+		contentType string
+		title       string
+		itemTitle   string
+	}{
+		// charset declared in the XML prolog only
+		{"iso-8859-1.xml", "", "Déjà vu", "Crème brûlée à la française"},
+		{"windows-1252.xml", "", "“Smart” quotes", "Prices rise – 5 € more"},
+		{"shift_jis.xml", "", "日本語ニュース", "東京の天気は晴れ"},
+		{"koi8-r.xml", "", "Новости", "Привет, мир"},
+		{"koi8-r.xml", "application/rss+xml", "Новости", "Привет, мир"},
+		// charset given by the Content-Type header only
+		{"koi8-r-undeclared.xml", "application/rss+xml; charset=KOI8-R", "Новости", "Привет, мир"},
+		// charset given by both
+		{"koi8-r.xml", "text/xml; charset=koi8-r", "Новости", "Привет, мир"},
+		{"shift_jis.xml", "text/xml; charset=\"Shift_JIS\"", "日本語ニュース", "東京の天気は晴れ"},
+	}
+	for _, tt := range tests {
+		f := parseFile(t, tt.file, tt.contentType, "")
+		if f.Title != tt.title {
+			t.Errorf("%s (%q): title = %q, want %q", tt.file, tt.contentType, f.Title, tt.title)
+		}
+		if len(f.Items) != 1 {
+			t.Errorf("%s (%q): %d items, want 1", tt.file, tt.contentType, len(f.Items))
+			continue
+		}
+		if f.Items[0].Title != tt.itemTitle {
+			t.Errorf("%s (%q): item title = %q, want %q", tt.file, tt.contentType, f.Items[0].Title, tt.itemTitle)
+		}
+	}
+}
+
+func TestParseCharsetFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+		title       string
+	}{
+		{
+			name:  "invalid UTF-8 is read as windows-1252",
+			doc:   "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<rss version=\"2.0\"><channel><title>Caf\xe9</title></channel></rss>",
+			title: "Café",
+		},
+		{
+			name:        "wrong header charset of a UTF-8 document",
+			doc:         "<rss version=\"2.0\"><channel><title>Café</title></channel></rss>",
+			contentType: "text/xml; charset=utf-8",
+			title:       "Café",
+		},
+		{
+			name:  "UTF-16 with byte order mark",
+			doc:   "\xff\xfe<\x00r\x00s\x00s\x00>\x00<\x00c\x00h\x00a\x00n\x00n\x00e\x00l\x00>\x00<\x00t\x00i\x00t\x00l\x00e\x00>\x00\xe9\x00<\x00/\x00t\x00i\x00t\x00l\x00e\x00>\x00<\x00/\x00c\x00h\x00a\x00n\x00n\x00e\x00l\x00>\x00<\x00/\x00r\x00s\x00s\x00>\x00",
+			title: "é",
+		},
+	}
+	for _, tt := range tests {
+		f, err := Parse(strings.NewReader(tt.doc), tt.contentType, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if f.Title != tt.title {
+			t.Errorf("%s: title = %q, want %q", tt.name, f.Title, tt.title)
+		}
+	}
+}
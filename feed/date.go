@@ -0,0 +1,136 @@
+package feed
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayouts are tried in order by ParseDate.
+//
+// Leading weekdays are removed before parsing. Fractional seconds are accepted
+// by time.Parse even if the layout does not specify them.
+var dateLayouts = []string{
+	// RFC 822, 1123 and variations
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+	// RFC 850
+	"2-Jan-06 15:04:05 MST",
+	"2-Jan-2006 15:04:05 MST",
+	// ANSI C, Unix date
+	"Mon Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+	"Jan 2, 2006 15:04:05 MST",
+	"January 2, 2006",
+	// ISO 8601, RFC 3339 and variations
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05 -0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// zoneOffsets maps common time zone abbreviations to their offset in seconds.
+//
+// time.Parse only knows abbreviations of the local time zone and assumes an
+// offset of zero for all others.
+var zoneOffsets = map[string]int{
+	"EST":  -5 * 3600,
+	"EDT":  -4 * 3600,
+	"CST":  -6 * 3600,
+	"CDT":  -5 * 3600,
+	"MST":  -7 * 3600,
+	"MDT":  -6 * 3600,
+	"PST":  -8 * 3600,
+	"PDT":  -7 * 3600,
+	"AKST": -9 * 3600,
+	"AKDT": -8 * 3600,
+	"HST":  -10 * 3600,
+	"BST":  1 * 3600,
+	"CET":  1 * 3600,
+	"CEST": 2 * 3600,
+	"MET":  1 * 3600,
+	"MEST": 2 * 3600,
+	"EET":  2 * 3600,
+	"EEST": 3 * 3600,
+	"MSK":  3 * 3600,
+	"JST":  9 * 3600,
+	"KST":  9 * 3600,
+	"AEST": 10 * 3600,
+	"AEDT": 11 * 3600,
+	"NZST": 12 * 3600,
+	"NZDT": 13 * 3600,
+}
+
+// ParseDate parses the many date formats found in real world feeds. The zero
+// time is returned if the date can not be parsed.
+func ParseDate(s string) time.Time {
+	s = normalizeDate(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		name, offset := t.Zone()
+		if offset == 0 {
+			if o, ok := zoneOffsets[name]; ok {
+				t = time.Date(
+					t.Year(), t.Month(), t.Day(),
+					t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
+					time.FixedZone(name, o),
+				)
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// normalizeDate removes noise that would otherwise require even more layouts.
+func normalizeDate(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	// remove comments like "+0000 (UTC)"
+	if i := strings.IndexByte(s, '('); i > 0 && strings.HasSuffix(s, ")") {
+		s = strings.TrimSpace(s[:i])
+	}
+	// remove weekdays as they're redundant and often misspelled or localized
+	if i := strings.IndexByte(s, ','); i > 0 && isLetters(s[:i]) {
+		s = strings.TrimSpace(s[i+1:])
+	}
+	switch {
+	case strings.HasSuffix(s, " UT"), strings.HasSuffix(s, " Z"):
+		s = s[:strings.LastIndexByte(s, ' ')] + " UTC"
+	}
+	return s
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
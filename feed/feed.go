@@ -0,0 +1,249 @@
+// Package feed parses syndication feeds into a common model that maps to the
+// feed and feed_item tables of rssd.
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Feed is the format independent representation of a parsed feed.
+type Feed struct {
+	Title       string
+	Link        string // website of the feed
+	Description string
+	Language    string
+	Items       []*Item
+
+	// Self is the URL of the feed itself as stated by the document.
+	Self string
+	// NewFeedURL is the URL the feed has moved to as stated by the document.
+	NewFeedURL string
+	// Hub is the URL of the WebSub hub pushing updates of the feed.
+	Hub string
+
+	// TTL is the time the feed may be cached as stated by <ttl> or the
+	// syndication module. Zero if unknown.
+	TTL time.Duration
+	// SkipHours are hours in UTC during which the feed should not be fetched.
+	SkipHours []int
+	// SkipDays are days during which the feed should not be fetched.
+	SkipDays []time.Weekday
+
+	// Warnings describe problems of a malformed document that was repaired
+	// before parsing. Empty if the document was well-formed.
+	Warnings []string
+}
+
+// Item is a single entry of a Feed.
+type Item struct {
+	GUID        string
+	Title       string
+	Link        string
+	Published   time.Time // zero if unknown
+	Updated     time.Time // zero if unknown
+	Author      Person
+	Description string // summary or teaser, may contain HTML
+	Content     string // full content, may contain HTML
+	Categories  []string
+	Enclosures  []*Enclosure
+	Image       string // URL of a cover image or thumbnail
+	Episode     int    // podcast episode number, zero if unknown
+	Season      int    // podcast season number, zero if unknown
+}
+
+// Person is the author of an Item.
+type Person struct {
+	Name  string
+	Email string
+}
+
+// IsZero returns true if neither name nor email are known.
+func (p Person) IsZero() bool {
+	return p.Name == "" && p.Email == ""
+}
+
+// Enclosure is a media file attached to an Item.
+type Enclosure struct {
+	URL      string
+	Type     string // MIME type
+	Length   int64  // size in bytes, zero if unknown
+	Title    string
+	Duration time.Duration // playback duration, zero if unknown
+}
+
+// Parse reads a feed document. JSON Feed is detected by the first character,
+// XML formats by the root element.
+//
+// The document is transcoded to UTF-8 first, see toUTF8. contentType is the
+// value of the Content-Type header and may be empty.
+//
+// Relative links are resolved against base, usually the URL the document was
+// fetched from. base may be nil.
+func Parse(r io.Reader, contentType string, base *url.URL) (*Feed, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err = toUTF8(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(data))
+	var f *Feed
+	if isJSON(br) {
+		f, err = parseJSON(br)
+	} else {
+		f, err = parseXML(data, base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Link = resolveURL(base, f.Link)
+	f.Self = resolveURL(base, f.Self)
+	f.NewFeedURL = resolveURL(base, f.NewFeedURL)
+	for _, item := range f.Items {
+		item.Link = resolveURL(base, item.Link)
+		item.Image = resolveURL(base, item.Image)
+		// merge enclosures that only differed by relative and absolute URL
+		enclosures := item.Enclosures
+		item.Enclosures = nil
+		for _, e := range enclosures {
+			e.URL = resolveURL(base, e.URL)
+			item.addEnclosure(e)
+		}
+		if item.GUID == "" {
+			item.GUID = deriveGUID(item)
+		}
+	}
+	return f, nil
+}
+
+// parseXML reads any of the supported XML formats.
+//
+// Malformed documents are repaired and parsed again, see repairXML. The
+// warnings of the Feed describe what was wrong with the document.
+func parseXML(data []byte, base *url.URL) (*Feed, error) {
+	var warnings []string
+	root, err := decodeXML(data)
+	if err != nil {
+		repaired, repairs, rerr := repairXML(data)
+		if rerr != nil {
+			return nil, err
+		}
+		warnings = append([]string{err.Error()}, repairs...)
+		root, err = decodeXML(repaired)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, err := parseRoot(root, base)
+	if err != nil {
+		return nil, err
+	}
+	f.Warnings = warnings
+	return f, nil
+}
+
+func decodeXML(data []byte) (*node, error) {
+	root := &node{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// the input has already been transcoded to UTF-8 by Parse, so the
+	// declared encoding of the prolog must be ignored.
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return root, d.Decode(root)
+}
+
+// parseRoot dispatches to the parser of the format given by the root element.
+func parseRoot(root *node, base *url.URL) (*Feed, error) {
+	switch root.XMLName.Local {
+	case "rss":
+		return parseRSS(root)
+	case "feed":
+		return parseAtom(root, base)
+	case "RDF":
+		if root.XMLName.Space == nsRDF {
+			return parseRDF(root)
+		}
+	}
+	return nil, fmt.Errorf("unsupported feed format with root element <%s>", root.XMLName.Local)
+}
+
+// isJSON returns true if the first character other than whitespace or a byte
+// order mark starts a JSON object. The whitespace is consumed.
+func isJSON(br *bufio.Reader) bool {
+	for {
+		r, _, err := br.ReadRune()
+		if err != nil {
+			return false
+		}
+		if r == '\uFEFF' || unicode.IsSpace(r) {
+			continue
+		}
+		br.UnreadRune()
+		return r == '{'
+	}
+}
+
+// appendCategory appends a category unless it's empty or a duplicate.
+func appendCategory(categories []string, c string) []string {
+	if c == "" {
+		return categories
+	}
+	for _, existing := range categories {
+		if existing == c {
+			return categories
+		}
+	}
+	return append(categories, c)
+}
+
+// resolveURL returns ref resolved against base. ref is returned unchanged if
+// base is nil or ref is not a valid URL.
+func resolveURL(base *url.URL, ref string) string {
+	if base == nil || ref == "" {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// IsHTTP returns true if s is an absolute HTTP or HTTPS URL.
+func IsHTTP(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// CollapseSpace trims s and replaces runs of white space by a single space.
+func CollapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// deriveGUID returns a stable identifier for items that have none.
+//
+// The link is preferred as it's usually unique. Otherwise a hash of title and
+// description is used.
+func deriveGUID(item *Item) string {
+	if item.Link != "" {
+		return item.Link
+	}
+	h := sha1.New()
+	io.WriteString(h, item.Title)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, item.Description)
+	return "sha1:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,410 @@
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseFile(t *testing.T, name, contentType, base string) *Feed {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var u *url.URL
+	if base != "" {
+		u, err = url.Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := Parse(f, contentType, u)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return doc
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file string
+		base string // URL the document was fetched from
+		want *Feed
+	}{
+		{
+			file: "rss091.xml",
+			want: &Feed{
+				Title:       "WriteTheWeb",
+				Link:        "http://writetheweb.com",
+				Description: "News for web users that write back",
+				Language:    "en-us",
+				SkipHours:   []int{0, 1},
+				SkipDays:    []time.Weekday{time.Saturday, time.Sunday},
+				Items: []*Item{
+					{
+						// derived from the link
+						GUID:        "http://writetheweb.com/read.php?item=24",
+						Title:       "Giving the world a pluggable Gnutella",
+						Link:        "http://writetheweb.com/read.php?item=24",
+						Description: "WorldOS is a framework on which to build programs that work like Freenet or Gnutella -allowing distributed applications using peer-to-peer routing.",
+					},
+					{
+						GUID:        "http://writetheweb.com/read.php?item=23",
+						Title:       "Syndication discussions hot up",
+						Link:        "http://writetheweb.com/read.php?item=23",
+						Description: "After a period of dormancy, the Syndication mailing list has become active again, with contributions from leaders in traditional media and Web syndication.",
+					},
+				},
+			},
+		},
+		{
+			file: "rss2.xml",
+			base: "http://liftoff.msfc.nasa.gov/rss.xml",
+			want: &Feed{
+				Title:       "Liftoff News",
+				Link:        "http://liftoff.msfc.nasa.gov/",
+				Description: "Liftoff to Space Exploration.",
+				Language:    "en-us",
+				Self:        "http://liftoff.msfc.nasa.gov/rss.xml",
+				NewFeedURL:  "http://liftoff.msfc.nasa.gov/news.xml",
+				Hub:         "https://pubsubhubbub.appspot.com/",
+				// sy:updatePeriod is longer than ttl
+				TTL: time.Hour,
+				Items: []*Item{
+					{
+						GUID:        "http://liftoff.msfc.nasa.gov/2003/06/03.html#item573",
+						Title:       "Star City",
+						Link:        "http://liftoff.msfc.nasa.gov/news/2003/news-starcity.asp",
+						Published:   date("2003-06-03T09:39:21Z"),
+						Author:      Person{Name: "Jane Doe", Email: "jane@example.com"},
+						Description: `How do Americans get ready to work with Russians aboard the International Space Station? They take a crash course in culture, language and protocol at Russia's <a href="http://howe.iki.rssi.ru/GCTC/gctc_e.htm">Star City</a>.`,
+						Categories:  []string{"Space", "Russia"},
+					},
+					{
+						// the guid is a permalink
+						GUID:        "http://liftoff.msfc.nasa.gov/2003/05/30.html#item572",
+						Link:        "http://liftoff.msfc.nasa.gov/2003/05/30.html#item572",
+						Published:   date("2003-05-30T11:06:42-05:00"),
+						Author:      Person{Name: "John Doe"},
+						Description: `Sky watchers in Europe, Asia, and parts of Alaska and Canada will experience a <a href="http://science.nasa.gov/headlines/y2003/30may_solareclipse.htm">partial eclipse of the Sun</a> on Saturday, May 31st.`,
+					},
+					{
+						GUID:        "item571",
+						Title:       "The Engine That Does More",
+						Link:        "http://liftoff.msfc.nasa.gov/news/2003/news-VASIMR.asp",
+						Published:   date("2003-05-27T08:37:32-04:00"),
+						Description: "Before man travels to Mars, NASA hopes to design new engines that will let us fly through the Solar System more quickly.",
+						Content:     "<p>The proposed <b>VASIMR</b> engine would do that.</p>",
+						Categories:  []string{"Engines"},
+					},
+					{
+						GUID:        "http://liftoff.msfc.nasa.gov/2003/05/20.html#item570",
+						Title:       "Astronauts' Dirty Laundry",
+						Link:        "http://liftoff.msfc.nasa.gov/news/2003/news-laundry.asp",
+						Published:   date("2003-05-20T08:56:02Z"),
+						Description: "Compared to earlier spacecraft, the International Space Station has many luxuries, but laundry facilities are not one of them.",
+						// the relative enclosure and media:content are merged
+						Enclosures: []*Enclosure{{
+							URL:      "http://liftoff.msfc.nasa.gov/audio/laundry.mp3",
+							Type:     "audio/mpeg",
+							Length:   12216320,
+							Duration: 12*time.Minute + 34*time.Second,
+						}},
+						Image:   "http://liftoff.msfc.nasa.gov/images/laundry.jpg",
+						Episode: 3,
+						Season:  1,
+					},
+				},
+			},
+		},
+		{
+			file: "rss090.rdf",
+			want: &Feed{
+				Title:       "Mozilla Dot Org",
+				Link:        "http://www.mozilla.org",
+				Description: "the Mozilla Organization web site",
+				Items: []*Item{
+					{
+						GUID:  "http://www.mozilla.org/status/",
+						Title: "New Status Updates",
+						Link:  "http://www.mozilla.org/status/",
+					},
+					{
+						GUID:  "http://www.mozilla.org/bugs/",
+						Title: "Bugzilla Reorganized",
+						Link:  "http://www.mozilla.org/bugs/",
+					},
+				},
+			},
+		},
+		{
+			file: "rss10.rdf",
+			want: &Feed{
+				Title:       "XML.com",
+				Link:        "http://xml.com/pub",
+				Description: "XML.com features a rich mix of information and services for the XML community.",
+				Language:    "en-us",
+				TTL:         12 * time.Hour,
+				Items: []*Item{
+					{
+						GUID:        "http://xml.com/pub/2000/08/09/xslt/xslt.html",
+						Title:       "Processing Inclusions with XSLT",
+						Link:        "http://xml.com/pub/2000/08/09/xslt/xslt.html",
+						Published:   date("2000-08-09T12:00:00Z"),
+						Author:      Person{Name: "Bob DuCharme"},
+						Description: "Processing document inclusions with general XML tools can be problematic. This article proposes a way of preserving inclusion information through SAX-based processing.",
+						Categories:  []string{"XSLT", "SAX"},
+					},
+					{
+						GUID:        "http://xml.com/pub/2000/08/09/rdfdb/index.html",
+						Title:       "Putting RDF to Work",
+						Link:        "http://xml.com/pub/2000/08/09/rdfdb/index.html",
+						Published:   date("2000-08-09T00:00:00Z"),
+						Description: "Tool and API support for the Resource Description Framework is slowly coming of age.",
+						Content:     "<p>Edd Dumbill takes a look at <em>RDFDB</em>.</p>",
+					},
+				},
+			},
+		},
+		{
+			file: "atom.xml",
+			base: "http://example.org/feed.atom",
+			want: &Feed{
+				Title:       "dive into mark",
+				Link:        "http://example.org/blog/",
+				Description: "A lot of effort went into making this effortless",
+				Language:    "en",
+				Self:        "http://example.org/blog/feed.atom",
+				Hub:         "https://hub.example.org/",
+				Items: []*Item{
+					{
+						GUID:       "tag:example.org,2003:3.2397",
+						Title:      "Atom draft-07 snapshot",
+						Link:       "http://example.org/blog/2005/04/02/atom",
+						Published:  date("2003-12-13T08:29:29-04:00"),
+						Updated:    date("2005-07-31T12:29:29Z"),
+						Author:     Person{Name: "Mark Pilgrim"},
+						Content:    "<p><i>[Update: The Atom draft is finished.]</i></p>",
+						Categories: []string{"atom", "Syndication"},
+						Enclosures: []*Enclosure{{
+							URL:    "http://example.org/audio/ph34r_my_podcast.mp3",
+							Type:   "audio/mpeg",
+							Length: 1337,
+						}},
+					},
+					{
+						GUID:  "tag:example.org,2003:3.2398",
+						Title: "Less is more",
+						// xml:base of the entry is relative to the feed's
+						Link:        "http://example.org/archive/2005/07/less",
+						Published:   date("2005-07-30T10:00:00+02:00"),
+						Updated:     date("2005-07-30T10:00:00+02:00"),
+						Author:      Person{Name: "Mark Pilgrim", Email: "f8dy@example.com"},
+						Description: "Plain text &amp; no markup",
+					},
+				},
+			},
+		},
+		{
+			file: "jsonfeed10.json",
+			base: "https://example.org/feed.json",
+			want: &Feed{
+				Title:       "JSON Feed 1.0",
+				Link:        "https://example.org/",
+				Description: "Version 1.0 with a single author",
+				Items: []*Item{
+					{
+						GUID:        "2",
+						Title:       "HTML and text",
+						Link:        "https://example.org/2",
+						Published:   date("2017-05-17T10:02:12-07:00"),
+						Updated:     date("2017-05-18T08:00:00Z"),
+						Author:      Person{Name: "Item Author"},
+						Description: "Short",
+						Content:     "<p>HTML wins</p>",
+						Categories:  []string{"go", "json"},
+					},
+					{
+						// numeric id, external_url as link, date_modified
+						// as publication date and escaped content_text
+						GUID:      "1",
+						Link:      "https://elsewhere.example.com/post",
+						Published: date("2017-05-16T08:00:00Z"),
+						Updated:   date("2017-05-16T08:00:00Z"),
+						Author:    Person{Name: "Feed Author"},
+						Content:   "Plain &lt;text&gt; &amp; more",
+						Enclosures: []*Enclosure{{
+							URL:      "https://example.org/podcast.mp3",
+							Type:     "audio/mpeg",
+							Length:   1234,
+							Title:    "Episode",
+							Duration: 90500 * time.Millisecond,
+						}},
+					},
+				},
+			},
+		},
+		{
+			file: "jsonfeed11.json",
+			base: "https://example.org/feed.json",
+			want: &Feed{
+				Title:    "JSON Feed 1.1",
+				Link:     "https://example.org/",
+				Language: "en-US",
+				Items: []*Item{
+					{
+						GUID:      "https://example.org/1",
+						Title:     "Inherited author",
+						Link:      "https://example.org/1",
+						Published: date("2020-08-07T11:44:36Z"),
+						Author:    Person{Name: "First Author"},
+						Content:   "<p>Hello</p>",
+						Image:     "https://example.org/cover.png",
+					},
+					{
+						GUID:    "https://example.org/2",
+						Title:   "Deprecated author is ignored",
+						Link:    "https://example.org/2",
+						Author:  Person{Name: "New Author"},
+						Content: "Text",
+						Enclosures: []*Enclosure{{
+							URL:  "https://example.org/a.pdf",
+							Type: "application/pdf",
+						}},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got := parseFile(t, tt.file, "", tt.base)
+			checkFeed(t, got, tt.want)
+		})
+	}
+}
+
+func checkFeed(t *testing.T, got, want *Feed) {
+	t.Helper()
+	gotItems, wantItems := got.Items, want.Items
+	g, w := *got, *want
+	g.Items, w.Items = nil, nil
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("feed\ngot  %+v\nwant %+v", g, w)
+	}
+	if len(gotItems) != len(wantItems) {
+		t.Fatalf("got %d items, want %d", len(gotItems), len(wantItems))
+	}
+	for i := range wantItems {
+		checkItem(t, i, gotItems[i], wantItems[i])
+	}
+}
+
+func checkItem(t *testing.T, i int, got, want *Item) {
+	t.Helper()
+	if !got.Published.Equal(want.Published) {
+		t.Errorf("item %d: published %v, want %v", i, got.Published, want.Published)
+	}
+	if !got.Updated.Equal(want.Updated) {
+		t.Errorf("item %d: updated %v, want %v", i, got.Updated, want.Updated)
+	}
+	g, w := *got, *want
+	g.Published, w.Published = time.Time{}, time.Time{}
+	g.Updated, w.Updated = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(g.Enclosures, w.Enclosures) {
+		t.Errorf("item %d: enclosures\ngot  %s\nwant %s", i, enclosures(g.Enclosures), enclosures(w.Enclosures))
+	}
+	g.Enclosures, w.Enclosures = nil, nil
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("item %d\ngot  %+v\nwant %+v", i, g, w)
+	}
+}
+
+func enclosures(es []*Enclosure) string {
+	s := ""
+	for _, e := range es {
+		s += fmt.Sprintf("%+v ", *e)
+	}
+	return s
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // RFC 3339, empty for the zero time
+	}{
+		// RFC 822 and 1123
+		{"Tue, 03 Jun 2003 09:39:21 GMT", "2003-06-03T09:39:21Z"},
+		{"Tue, 03 Jun 2003 09:39:21 +0200", "2003-06-03T09:39:21+02:00"},
+		{"Tue, 03 Jun 2003 09:39:21 +02:00", "2003-06-03T09:39:21+02:00"},
+		{"3 Jun 2003 09:39 -0700", "2003-06-03T09:39:00-07:00"},
+		{"3 June 2003 09:39:21 -0700", "2003-06-03T09:39:21-07:00"},
+		{"Tue, 03 Jun 03 09:39:21 +0000", "2003-06-03T09:39:21Z"},
+		{"03 Jun 2003 09:39:21", "2003-06-03T09:39:21Z"},
+		{"03 Jun 2003", "2003-06-03T00:00:00Z"},
+		// zone abbreviations unknown to time.Parse
+		{"Fri, 30 May 2003 11:06:42 EST", "2003-05-30T11:06:42-05:00"},
+		{"Fri, 30 May 2003 11:06:42 PDT", "2003-05-30T11:06:42-07:00"},
+		{"Fri, 30 May 2003 11:06:42 CEST", "2003-05-30T11:06:42+02:00"},
+		{"Fri, 30 May 2003 11:06:42 JST", "2003-05-30T11:06:42+09:00"},
+		// noise
+		{"  Fri,  30 May 2003\n11:06:42 +0000 ", "2003-05-30T11:06:42Z"},
+		{"Fri, 30 May 2003 11:06:42 +0000 (UTC)", "2003-05-30T11:06:42Z"},
+		{"Freitag, 30 May 2003 11:06:42 +0000", "2003-05-30T11:06:42Z"},
+		{"Fri, 30 May 2003 11:06:42 UT", "2003-05-30T11:06:42Z"},
+		{"Fri, 30 May 2003 11:06:42 Z", "2003-05-30T11:06:42Z"},
+		// RFC 850, ANSI C, Unix date
+		{"Friday, 30-May-03 11:06:42 GMT", "2003-05-30T11:06:42Z"},
+		{"Fri May 30 11:06:42 2003", "2003-05-30T11:06:42Z"},
+		{"Fri May  3 11:06:42 2003", "2003-05-03T11:06:42Z"},
+		{"Fri May 30 11:06:42 EST 2003", "2003-05-30T11:06:42-05:00"},
+		{"May 30, 2003 11:06:42 GMT", "2003-05-30T11:06:42Z"},
+		{"May 30, 2003", "2003-05-30T00:00:00Z"},
+		// ISO 8601 and RFC 3339
+		{"2003-05-27T08:37:32-04:00", "2003-05-27T08:37:32-04:00"},
+		{"2003-05-27T08:37:32.123Z", "2003-05-27T08:37:32.123Z"},
+		{"2003-05-27T08:37:32-0400", "2003-05-27T08:37:32-04:00"},
+		{"2003-05-27T08:37Z", "2003-05-27T08:37:00Z"},
+		{"2003-05-27T08:37:32", "2003-05-27T08:37:32Z"},
+		{"2003-05-27 08:37:32 -0400", "2003-05-27T08:37:32-04:00"},
+		{"2003-05-27 08:37:32", "2003-05-27T08:37:32Z"},
+		{"2003-05-27 08:37", "2003-05-27T08:37:00Z"},
+		{"2003-05-27", "2003-05-27T00:00:00Z"},
+		// invalid
+		{"", ""},
+		{"yesterday", ""},
+		{"2003-13-45", ""},
+	}
+	for _, tt := range tests {
+		got := ParseDate(tt.in)
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("ParseDate(%q) = %v, want zero time", tt.in, got)
+			}
+			continue
+		}
+		want, err := time.Parse(time.RFC3339Nano, tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, gotOffset := got.Zone()
+		_, wantOffset := want.Zone()
+		if !got.Equal(want) || gotOffset != wantOffset {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.in, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// jsonFeed is a JSON Feed 1.0 or 1.1 document.
+//
+// See https://jsonfeed.org/version/1.1
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url"`
+	FeedURL     string       `json:"feed_url"`
+	Description string       `json:"description"`
+	Language    string       `json:"language"`
+	Author      *jsonAuthor  `json:"author"`  // 1.0
+	Authors     []jsonAuthor `json:"authors"` // 1.1
+	Items       []jsonItem   `json:"items"`
+	Hubs        []jsonHub    `json:"hubs"`
+}
+
+type jsonHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonItem struct {
+	ID            jsonID           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Author        *jsonAuthor      `json:"author"`  // 1.0
+	Authors       []jsonAuthor     `json:"authors"` // 1.1
+	Image         string           `json:"image"`
+	Tags          []string         `json:"tags"`
+	Attachments   []jsonAttachment `json:"attachments"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type jsonAttachment struct {
+	URL      string  `json:"url"`
+	MimeType string  `json:"mime_type"`
+	Title    string  `json:"title"`
+	Size     int64   `json:"size_in_bytes"`
+	Duration float64 `json:"duration_in_seconds"`
+}
+
+// jsonID is an item id. The spec requires a string but some feeds use numbers.
+type jsonID string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (id *jsonID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*id = jsonID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*id = jsonID(n.String())
+	return nil
+}
+
+// parseJSON maps a JSON Feed document to a Feed.
+func parseJSON(r io.Reader) (*Feed, error) {
+	doc := &jsonFeed{}
+	err := json.NewDecoder(r).Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, errors.New("json: unsupported version " + doc.Version)
+	}
+	f := &Feed{
+		Title:       strings.TrimSpace(doc.Title),
+		Link:        strings.TrimSpace(doc.HomePageURL),
+		Description: strings.TrimSpace(doc.Description),
+		Language:    strings.TrimSpace(doc.Language),
+	}
+	for _, h := range doc.Hubs {
+		if strings.EqualFold(h.Type, "websub") && f.Hub == "" {
+			f.Hub = strings.TrimSpace(h.URL)
+		}
+	}
+	author := jsonAuthorName(doc.Author, doc.Authors)
+	for _, it := range doc.Items {
+		item := &Item{
+			GUID:        strings.TrimSpace(string(it.ID)),
+			Title:       strings.TrimSpace(it.Title),
+			Link:        strings.TrimSpace(it.URL),
+			Published:   ParseDate(it.DatePublished),
+			Updated:     ParseDate(it.DateModified),
+			Author:      jsonAuthorName(it.Author, it.Authors),
+			Description: strings.TrimSpace(it.Summary),
+			Content:     strings.TrimSpace(it.ContentHTML),
+			Image:       strings.TrimSpace(it.Image),
+		}
+		if item.Link == "" {
+			item.Link = strings.TrimSpace(it.ExternalURL)
+		}
+		if item.Published.IsZero() {
+			item.Published = item.Updated
+		}
+		if item.Author.IsZero() {
+			item.Author = author
+		}
+		for _, tag := range it.Tags {
+			item.Categories = appendCategory(item.Categories, strings.TrimSpace(tag))
+		}
+		if item.Content == "" && it.ContentText != "" {
+			item.Content = html.EscapeString(strings.TrimSpace(it.ContentText))
+		}
+		for _, a := range it.Attachments {
+			item.addEnclosure(&Enclosure{
+				URL:      a.URL,
+				Type:     a.MimeType,
+				Length:   a.Size,
+				Title:    a.Title,
+				Duration: time.Duration(a.Duration * float64(time.Second)),
+			})
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+// jsonAuthorName returns the first author with a name. 1.1 authors are
+// preferred over the deprecated 1.0 author.
+func jsonAuthorName(author *jsonAuthor, authors []jsonAuthor) Person {
+	for _, a := range authors {
+		if a.Name != "" {
+			return Person{Name: strings.TrimSpace(a.Name)}
+		}
+	}
+	if author != nil {
+		return Person{Name: strings.TrimSpace(author.Name)}
+	}
+	return Person{}
+}
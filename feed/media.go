@@ -0,0 +1,95 @@
+package feed
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseMedia adds enclosures and podcast metadata of the Media RSS and iTunes
+// extensions to an item. It should be called after format specific
+// enclosures have been added.
+func parseMedia(n *node, item *Item) {
+	groups := append([]*node{n}, n.children(nsMedia, "group")...)
+	for _, g := range groups {
+		for _, c := range g.children(nsMedia, "content") {
+			item.addEnclosure(&Enclosure{
+				URL:      strings.TrimSpace(c.attr("", "url")),
+				Type:     c.attr("", "type"),
+				Length:   parseInt64(c.attr("", "fileSize")),
+				Title:    c.text(nsMedia, "title"),
+				Duration: time.Duration(parseInt64(c.attr("", "duration"))) * time.Second,
+			})
+		}
+		if item.Image == "" {
+			if t := g.child(nsMedia, "thumbnail"); t != nil {
+				item.Image = strings.TrimSpace(t.attr("", "url"))
+			}
+		}
+	}
+	if img := n.child(nsITunes, "image"); img != nil {
+		item.Image = strings.TrimSpace(img.attr("", "href"))
+	}
+	item.Episode = int(parseInt64(n.text(nsITunes, "episode")))
+	item.Season = int(parseInt64(n.text(nsITunes, "season")))
+	if d := parseDuration(n.text(nsITunes, "duration")); d > 0 {
+		for _, e := range item.Enclosures {
+			if e.Duration == 0 {
+				e.Duration = d
+			}
+		}
+	}
+}
+
+// addEnclosure appends e unless its URL is empty. Enclosures with the same URL
+// are merged.
+func (item *Item) addEnclosure(e *Enclosure) {
+	if e.URL == "" {
+		return
+	}
+	for _, existing := range item.Enclosures {
+		if existing.URL != e.URL {
+			continue
+		}
+		if existing.Type == "" {
+			existing.Type = e.Type
+		}
+		if existing.Length == 0 {
+			existing.Length = e.Length
+		}
+		if existing.Title == "" {
+			existing.Title = e.Title
+		}
+		if existing.Duration == 0 {
+			existing.Duration = e.Duration
+		}
+		return
+	}
+	item.Enclosures = append(item.Enclosures, e)
+}
+
+// parseDuration parses itunes:duration which is either seconds or of the form
+// "H:MM:SS" or "MM:SS". Zero is returned for invalid durations.
+func parseDuration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || f < 0 {
+			return 0
+		}
+		d = d*60 + time.Duration(f*float64(time.Second))
+	}
+	return d
+}
+
+// parseInt64 returns the integer value of s or zero if it is invalid.
+func parseInt64(s string) int64 {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
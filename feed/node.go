@@ -0,0 +1,111 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// XML namespaces of supported extensions.
+const (
+	nsAtom    = "http://www.w3.org/2005/Atom"
+	nsContent = "http://purl.org/rss/1.0/modules/content/"
+	nsDC      = "http://purl.org/dc/elements/1.1/"
+	nsITunes  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	nsMedia   = "http://search.yahoo.com/mrss/"
+	nsRDF     = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsSy      = "http://purl.org/rss/1.0/modules/syndication/"
+	nsXHTML   = "http://www.w3.org/1999/xhtml"
+	nsXML     = "http://www.w3.org/XML/1998/namespace"
+)
+
+// node is a generic XML element.
+//
+// Decoding into a tree instead of format specific structs allows matching
+// elements by namespace exactly, e.g. telling <link> and <atom:link> apart.
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Inner   string     `xml:",innerxml"`
+	Nodes   []*node    `xml:",any"`
+}
+
+// is returns true if the node has the given namespace and local name.
+func (n *node) is(space, local string) bool {
+	return n.XMLName.Space == space && n.XMLName.Local == local
+}
+
+// child returns the first child element matching namespace and local name.
+func (n *node) child(space, local string) *node {
+	for _, c := range n.Nodes {
+		if c.is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns all child elements matching namespace and local name.
+func (n *node) children(space, local string) []*node {
+	var nodes []*node
+	for _, c := range n.Nodes {
+		if c.is(space, local) {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// text returns the trimmed text of the first matching child element.
+func (n *node) text(space, local string) string {
+	c := n.child(space, local)
+	if c == nil {
+		return ""
+	}
+	return strings.TrimSpace(c.Text)
+}
+
+// firstText returns the first non-empty text of the given children.
+func (n *node) firstText(names ...xml.Name) string {
+	for _, name := range names {
+		if t := n.text(name.Space, name.Local); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// innerText returns the text of the node and all its descendants in
+// document order.
+func (n *node) innerText() string {
+	return stripTags(n.Inner)
+}
+
+// stripTags returns the character data of a XML or HTML fragment.
+func stripTags(s string) string {
+	sb := &strings.Builder{}
+	d := xml.NewDecoder(strings.NewReader(s))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		if cd, ok := tok.(xml.CharData); ok {
+			sb.Write(cd)
+		}
+	}
+	return sb.String()
+}
+
+// attr returns the value of an attribute. Attributes without namespace are
+// matched using an empty space.
+func (n *node) attr(space, local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
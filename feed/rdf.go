@@ -0,0 +1,52 @@
+package feed
+
+import (
+	"errors"
+	"strings"
+)
+
+// parseRDF maps a RSS 1.0 or 0.90 document to a Feed.
+//
+// Unlike RSS 2.0 the items are siblings of the channel. Their rdf:about
+// attribute identifies them.
+func parseRDF(root *node) (*Feed, error) {
+	var ch *node
+	for _, n := range root.Nodes {
+		if n.XMLName.Local == "channel" {
+			ch = n
+			break
+		}
+	}
+	if ch == nil {
+		return nil, errors.New("rdf: missing channel element")
+	}
+	// RSS 1.0 and 0.90 differ only by namespace
+	ns := ch.XMLName.Space
+	f := &Feed{
+		Title:       ch.text(ns, "title"),
+		Link:        ch.text(ns, "link"),
+		Description: ch.text(ns, "description"),
+		Language:    ch.text(nsDC, "language"),
+	}
+	parseSchedule(ns, ch, f)
+	for _, n := range root.children(ns, "item") {
+		item := &Item{
+			GUID:        strings.TrimSpace(n.attr(nsRDF, "about")),
+			Title:       n.text(ns, "title"),
+			Link:        n.text(ns, "link"),
+			Published:   ParseDate(n.text(nsDC, "date")),
+			Author:      Person{Name: n.text(nsDC, "creator")},
+			Description: n.text(ns, "description"),
+			Content:     n.text(nsContent, "encoded"),
+		}
+		if item.Description == "" {
+			item.Description = n.text(nsDC, "description")
+		}
+		for _, c := range n.children(nsDC, "subject") {
+			item.Categories = appendCategory(item.Categories, strings.TrimSpace(c.Text))
+		}
+		parseMedia(n, item)
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
@@ -0,0 +1,202 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// repairXML rewrites a malformed XML document into a well-formed one. It
+// returns the repaired document and a description of each kind of repair.
+//
+// The document is tokenized in non-strict mode, which accepts unescaped
+// ampersands and undeclared entities. HTML entities like &nbsp; are
+// replaced by their characters. Characters that are not allowed in XML are
+// removed. HTML void elements like <br> are closed immediately. Unbalanced
+// end tags are dropped or close the elements they skip. Elements left open by
+// a truncated document are closed, except for an incomplete item or entry
+// which is dropped.
+//
+// The input must be UTF-8.
+func repairXML(data []byte) ([]byte, []string, error) {
+	var warnings []string
+	data, n := stripInvalidChars(data)
+	if n > 0 {
+		warnings = append(warnings, fmt.Sprintf("removed %d invalid characters", n))
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	buf := &bytes.Buffer{}
+	var open []xml.Name
+	var offsets []int // buffer offsets of the open elements
+	var unbalanced int
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(open) == 0 {
+				return nil, nil, err
+			}
+			warnings = append(warnings, fmt.Sprintf("document is truncated or broken: %v", err))
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if isVoid(t.Name) {
+				writeStart(buf, t)
+				writeEnd(buf, t.Name)
+				continue
+			}
+			offsets = append(offsets, buf.Len())
+			writeStart(buf, t)
+			open = append(open, t.Name)
+		case xml.EndElement:
+			i := len(open) - 1
+			for i >= 0 && open[i] != t.Name {
+				i--
+			}
+			if i < 0 {
+				// stray end tag without matching start
+				if !isVoid(t.Name) {
+					unbalanced++
+				}
+				continue
+			}
+			unbalanced += len(open) - 1 - i
+			for len(open) > i {
+				writeEnd(buf, open[len(open)-1])
+				open = open[:len(open)-1]
+				offsets = offsets[:len(offsets)-1]
+			}
+		case xml.CharData:
+			xml.EscapeText(buf, t)
+		case xml.Comment:
+			buf.WriteString("<!--")
+			buf.Write(bytes.Replace(t, []byte("--"), []byte("- -"), -1))
+			buf.WriteString("-->")
+		case xml.Directive:
+			buf.WriteString("<!")
+			buf.Write(t)
+			buf.WriteString(">")
+		case xml.ProcInst:
+			// the prolog is obsolete as the output is always UTF-8
+			if t.Target == "xml" {
+				continue
+			}
+			fmt.Fprintf(buf, "<?%s %s?>", t.Target, t.Inst)
+		}
+	}
+	if unbalanced > 0 {
+		warnings = append(warnings, fmt.Sprintf("fixed %d unbalanced tags", unbalanced))
+	}
+	for i := range open {
+		if open[i].Local == "item" || open[i].Local == "entry" {
+			buf.Truncate(offsets[i])
+			open = open[:i]
+			warnings = append(warnings, "dropped incomplete item at end of document")
+			break
+		}
+	}
+	if len(open) > 0 {
+		warnings = append(warnings, fmt.Sprintf("closed %d elements at end of document", len(open)))
+		for i := len(open) - 1; i >= 0; i-- {
+			writeEnd(buf, open[i])
+		}
+	}
+	return buf.Bytes(), warnings, nil
+}
+
+// voidElements are HTML elements that never have content. Unlike
+// xml.HTMLAutoClose it does not contain link, which has content in RSS.
+var voidElements = map[string]bool{
+	"area":  true,
+	"br":    true,
+	"col":   true,
+	"embed": true,
+	"hr":    true,
+	"img":   true,
+	"input": true,
+	"meta":  true,
+	"param": true,
+	"track": true,
+	"wbr":   true,
+}
+
+// isVoid returns true for unprefixed HTML void elements like <br>.
+func isVoid(name xml.Name) bool {
+	return name.Space == "" && voidElements[strings.ToLower(name.Local)]
+}
+
+// stripInvalidChars removes characters that are not allowed in XML 1.0, e.g.
+// most control characters, and returns the number of removed characters.
+func stripInvalidChars(data []byte) ([]byte, int) {
+	var out []byte
+	n := 0
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if isXMLChar(r) && !(r == utf8.RuneError && size == 1) {
+			if out != nil {
+				out = append(out, data[i:i+size]...)
+			}
+		} else {
+			if out == nil {
+				out = append(make([]byte, 0, len(data)), data[:i]...)
+			}
+			n++
+		}
+		i += size
+	}
+	if out == nil {
+		return data, 0
+	}
+	return out, n
+}
+
+// isXMLChar returns true if r matches the Char production of XML 1.0.
+func isXMLChar(r rune) bool {
+	return r == 0x09 ||
+		r == 0x0A ||
+		r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+func writeStart(buf *bytes.Buffer, t xml.StartElement) {
+	buf.WriteByte('<')
+	writeName(buf, t.Name)
+	for _, a := range t.Attr {
+		buf.WriteByte(' ')
+		writeName(buf, a.Name)
+		buf.WriteString(`="`)
+		xml.EscapeText(buf, []byte(a.Value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+}
+
+func writeEnd(buf *bytes.Buffer, name xml.Name) {
+	buf.WriteString("</")
+	writeName(buf, name)
+	buf.WriteByte('>')
+}
+
+// writeName writes a raw name, i.e. Space is the prefix and not the URL of
+// the namespace.
+func writeName(buf *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		buf.WriteString(name.Space)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(name.Local)
+}
@@ -0,0 +1,114 @@
+package feed
+
+import "testing"
+
+func TestParseRepaired(t *testing.T) {
+	tests := []struct {
+		file string
+		want *Feed
+	}{
+		{
+			file: "repair-ampersand.xml",
+			want: &Feed{
+				Title: "Tom & Jerry",
+				Link:  "http://example.com/?a=1&b=2",
+				Items: []*Item{{
+					GUID:        "http://example.com/post?id=1&page=2",
+					Title:       "Cats & Mice",
+					Link:        "http://example.com/post?id=1&page=2",
+					Description: "R&D",
+				}},
+				Warnings: []string{"XML syntax error on line 4: invalid character entity & (no semicolon)"},
+			},
+		},
+		{
+			file: "repair-entities.xml",
+			want: &Feed{
+				Title: "Caf\u00e9\u00a0News",
+				Link:  "http://example.com/",
+				Items: []*Item{{
+					GUID:  "http://example.com/1",
+					Title: "Open\u00a0\u2014\u00a0all\u00a0day \u00a9 \u00a9 &",
+					Link:  "http://example.com/1",
+				}},
+				Warnings: []string{"XML syntax error on line 4: invalid character entity &eacute;"},
+			},
+		},
+		{
+			file: "repair-control.xml",
+			want: &Feed{
+				Title: "Control characters",
+				Link:  "http://example.com/",
+				Items: []*Item{{
+					GUID:        "http://example.com/1",
+					Title:       "Formfeed",
+					Link:        "http://example.com/1",
+					Description: "abc\tok",
+				}},
+				Warnings: []string{
+					"XML syntax error on line 4: illegal character code U+0001",
+					"removed 4 invalid characters",
+				},
+			},
+		},
+		{
+			file: "repair-truncated.xml",
+			want: &Feed{
+				Title: "Truncated",
+				Link:  "http://example.com/",
+				Items: []*Item{{
+					GUID:  "http://example.com/1",
+					Title: "Complete",
+					Link:  "http://example.com/1",
+				}},
+				Warnings: []string{
+					"XML syntax error on line 13: unexpected EOF",
+					"document is truncated or broken: XML syntax error on line 13: unexpected EOF",
+					"dropped incomplete item at end of document",
+					"closed 2 elements at end of document",
+				},
+			},
+		},
+		{
+			file: "repair-unbalanced.xml",
+			want: &Feed{
+				Title: "Unbalanced",
+				Link:  "http://example.com/",
+				Items: []*Item{
+					{
+						GUID:  "sha1:8ce2b7869d7758844db678a41ea398907b963845",
+						Title: "Missing end tag",
+					},
+					{
+						GUID:  "http://example.com/2",
+						Title: "Stray end tag",
+						Link:  "http://example.com/2",
+					},
+				},
+				Warnings: []string{
+					"XML syntax error on line 7: element <title> closed by </item>",
+					"fixed 2 unbalanced tags",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got := parseFile(t, tt.file, "", "")
+			checkFeed(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseWellFormed(t *testing.T) {
+	got := parseFile(t, "rss2.xml", "", "")
+	if got.Warnings != nil {
+		t.Errorf("warnings %q for well-formed document", got.Warnings)
+	}
+}
+
+func TestRepairXMLUnrecoverable(t *testing.T) {
+	if _, _, err := repairXML([]byte("<rss version=\"2.0\"<channel>")); err == nil {
+		t.Error("no error for document without any element")
+	}
+}
@@ -0,0 +1,176 @@
+package feed
+
+import (
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRSS maps a RSS 0.9x or 2.0 document to a Feed.
+//
+// RSS elements are expected in the namespace of the root element, which is
+// usually empty. Extensions are matched by their namespace.
+func parseRSS(root *node) (*Feed, error) {
+	ns := root.XMLName.Space
+	ch := root.child(ns, "channel")
+	if ch == nil {
+		return nil, errors.New("rss: missing channel element")
+	}
+	f := &Feed{
+		Title:       ch.text(ns, "title"),
+		Link:        ch.text(ns, "link"),
+		Description: ch.text(ns, "description"),
+		Language:    ch.text(ns, "language"),
+	}
+	if f.Language == "" {
+		f.Language = ch.text(nsDC, "language")
+	}
+	parseSchedule(ns, ch, f)
+	for _, l := range ch.children(nsAtom, "link") {
+		switch l.attr("", "rel") {
+		case "self":
+			if f.Self == "" {
+				f.Self = strings.TrimSpace(l.attr("", "href"))
+			}
+		case "hub":
+			if f.Hub == "" {
+				f.Hub = strings.TrimSpace(l.attr("", "href"))
+			}
+		}
+	}
+	f.NewFeedURL = ch.text(nsITunes, "new-feed-url")
+	for _, n := range ch.children(ns, "item") {
+		f.Items = append(f.Items, parseRSSItem(ns, n))
+	}
+	return f, nil
+}
+
+func parseRSSItem(ns string, n *node) *Item {
+	item := &Item{
+		Title:       n.text(ns, "title"),
+		Link:        n.text(ns, "link"),
+		Description: n.text(ns, "description"),
+		Content:     n.text(nsContent, "encoded"),
+	}
+	if guid := n.child(ns, "guid"); guid != nil {
+		item.GUID = strings.TrimSpace(guid.Text)
+		// guids are permalinks unless stated otherwise
+		if item.Link == "" && guid.attr("", "isPermaLink") != "false" && IsHTTP(item.GUID) {
+			item.Link = item.GUID
+		}
+	}
+	item.Author = parseRSSAuthor(n.text(ns, "author"))
+	if creator := n.text(nsDC, "creator"); creator != "" {
+		item.Author.Name = creator
+	}
+	for _, c := range n.children(ns, "category") {
+		item.Categories = appendCategory(item.Categories, strings.TrimSpace(c.Text))
+	}
+	for _, c := range n.children(nsDC, "subject") {
+		item.Categories = appendCategory(item.Categories, strings.TrimSpace(c.Text))
+	}
+	for _, e := range n.children(ns, "enclosure") {
+		item.addEnclosure(&Enclosure{
+			URL:    strings.TrimSpace(e.attr("", "url")),
+			Type:   e.attr("", "type"),
+			Length: parseInt64(e.attr("", "length")),
+		})
+	}
+	parseMedia(n, item)
+	item.Published = ParseDate(n.text(ns, "pubDate"))
+	if item.Published.IsZero() {
+		item.Published = ParseDate(n.text(nsDC, "date"))
+	}
+	return item
+}
+
+// parseSchedule reads hints about when to fetch the feed from <ttl>,
+// <skipHours>, <skipDays> and the syndication module.
+func parseSchedule(ns string, ch *node, f *Feed) {
+	f.TTL = time.Duration(parseInt64(ch.text(ns, "ttl"))) * time.Minute
+	if d := parseUpdatePeriod(ch.text(nsSy, "updatePeriod"), ch.text(nsSy, "updateFrequency")); d > f.TTL {
+		f.TTL = d
+	}
+	if f.TTL < 0 {
+		f.TTL = 0
+	}
+	if sh := ch.child(ns, "skipHours"); sh != nil {
+		for _, h := range sh.children(ns, "hour") {
+			hour, err := strconv.Atoi(strings.TrimSpace(h.Text))
+			if err != nil || hour < 0 || hour > 24 {
+				continue
+			}
+			// some feeds use 1-24 instead of 0-23
+			f.SkipHours = append(f.SkipHours, hour%24)
+		}
+	}
+	if sd := ch.child(ns, "skipDays"); sd != nil {
+		for _, d := range sd.children(ns, "day") {
+			if wd, ok := weekdays[strings.ToLower(strings.TrimSpace(d.Text))]; ok {
+				f.SkipDays = append(f.SkipDays, wd)
+			}
+		}
+	}
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// parseUpdatePeriod returns the interval described by sy:updatePeriod and
+// sy:updateFrequency. Zero is returned if the period is unknown.
+func parseUpdatePeriod(period, frequency string) time.Duration {
+	var d time.Duration
+	switch strings.ToLower(period) {
+	case "hourly":
+		d = time.Hour
+	case "daily":
+		d = time.Hour * 24
+	case "weekly":
+		d = time.Hour * 24 * 7
+	case "monthly":
+		d = time.Hour * 24 * 30
+	case "yearly":
+		d = time.Hour * 24 * 365
+	default:
+		return 0
+	}
+	if n := parseInt64(frequency); n > 1 {
+		d /= time.Duration(n)
+	}
+	return d
+}
+
+// parseRSSAuthor splits the author element into name and email.
+//
+// The spec requires an email optionally followed by the name in parentheses,
+// but names alone or "Name <email>" are common as well.
+func parseRSSAuthor(s string) Person {
+	if s == "" {
+		return Person{}
+	}
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return Person{Name: addr.Name, Email: addr.Address}
+	}
+	if i := strings.IndexByte(s, '('); i > 0 && strings.HasSuffix(s, ")") {
+		email := strings.TrimSpace(s[:i])
+		if strings.Contains(email, "@") {
+			return Person{
+				Name:  strings.TrimSpace(s[i+1 : len(s)-1]),
+				Email: email,
+			}
+		}
+	}
+	if !strings.ContainsAny(s, " \t") && strings.Contains(s, "@") {
+		return Person{Email: s}
+	}
+	return Person{Name: s}
+}
@@ -0,0 +1,215 @@
+// Package jsonmap creates feeds from JSON APIs, using path expressions to
+// find the items of a document and their fields.
+//
+// A path is a list of object keys and array indexes separated by dots, e.g.
+// "data.children" or "links.0.href". The empty path is the value itself.
+package jsonmap
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nochso/rss/feed"
+)
+
+// Config selects the items of a document. All paths but Items are relative
+// to an item and optional.
+type Config struct {
+	// Items selects the array of items. Empty if the document itself is
+	// the array.
+	Items string
+	// Title selects the title.
+	Title string
+	// Link selects the link. Relative links are resolved against the URL of
+	// the document.
+	Link string
+	// ID selects the unique ID of an item. Defaults to the link.
+	ID string
+	// Date selects the publication date: a string in any format supported by
+	// feeds, or a number of seconds or milliseconds since the Unix epoch.
+	Date string
+}
+
+// Validate returns an error if any of the paths is invalid.
+func (c Config) Validate() error {
+	for _, p := range []struct{ name, path string }{
+		{"items", c.Items},
+		{"title", c.Title},
+		{"link", c.Link},
+		{"ID", c.ID},
+		{"date", c.Date},
+	} {
+		if _, err := split(p.path); err != nil {
+			return fmt.Errorf("invalid %s path: %v", p.name, err)
+		}
+	}
+	if c.Title == "" && c.Link == "" {
+		return fmt.Errorf("title or link path is required")
+	}
+	return nil
+}
+
+// Parser returns a function with the signature of feed.Parse that maps
+// documents using c.
+func (c Config) Parser() func(io.Reader, string, *url.URL) (*feed.Feed, error) {
+	return func(r io.Reader, contentType string, base *url.URL) (*feed.Feed, error) {
+		return Parse(r, base, c)
+	}
+}
+
+// Parse reads a JSON document and returns a feed of the items selected by c.
+// Relative links are resolved against base.
+//
+// Items without title and link are skipped. The GUID of an item is its ID,
+// its link or a hash of its title, whichever is found first.
+func Parse(r io.Reader, base *url.URL, c Config) (*feed.Feed, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc interface{}
+	err = dec.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := lookup(doc, c.Items)
+	if !ok {
+		return nil, fmt.Errorf("items path %q matched nothing", c.Items)
+	}
+	items, ok := list.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("items path %q is not an array", c.Items)
+	}
+	f := &feed.Feed{}
+	if base != nil {
+		f.Title = base.Host + strings.TrimSuffix(base.Path, "/")
+		f.Link = base.String()
+	}
+	for _, v := range items {
+		item := &feed.Item{
+			Title: feed.CollapseSpace(str(v, c.Title)),
+			Link:  resolve(base, str(v, c.Link)),
+		}
+		if c.Date != "" {
+			item.Published = date(v, c.Date)
+		}
+		if item.Title == "" && item.Link == "" {
+			continue
+		}
+		if c.ID != "" {
+			item.GUID = str(v, c.ID)
+		}
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			sum := sha1.Sum([]byte(item.Title))
+			item.GUID = "sha1:" + hex.EncodeToString(sum[:])
+		}
+		f.Items = append(f.Items, item)
+	}
+	if len(f.Items) == 0 {
+		return nil, fmt.Errorf("items path %q matched no items with a title or link", c.Items)
+	}
+	return f, nil
+}
+
+// split returns the segments of a path.
+func split(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	segs := strings.Split(path, ".")
+	for _, s := range segs {
+		if s == "" {
+			return nil, fmt.Errorf("empty segment in %q", path)
+		}
+	}
+	return segs, nil
+}
+
+// lookup returns the value at path, or false if any segment is missing.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	segs, err := split(path)
+	if err != nil {
+		return nil, false
+	}
+	for _, s := range segs {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			v, ok = t[s]
+			if !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// str returns the string or number at path, or an empty string.
+func str(v interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	v, _ = lookup(v, path)
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case json.Number:
+		return t.String()
+	}
+	return ""
+}
+
+// date returns the time at path, or the zero time.
+func date(v interface{}, path string) time.Time {
+	v, _ = lookup(v, path)
+	switch t := v.(type) {
+	case string:
+		return feed.ParseDate(strings.TrimSpace(t))
+	case json.Number:
+		n, err := t.Int64()
+		if err != nil {
+			f, err := t.Float64()
+			if err != nil {
+				return time.Time{}
+			}
+			n = int64(f)
+		}
+		if n > 1e12 {
+			// milliseconds
+			return time.Unix(n/1000, n%1000*int64(time.Millisecond)).UTC()
+		}
+		return time.Unix(n, 0).UTC()
+	}
+	return time.Time{}
+}
+
+func resolve(base *url.URL, href string) string {
+	if href == "" || base == nil {
+		return href
+	}
+	u, err := base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
@@ -0,0 +1,159 @@
+package jsonmap
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nochso/rss/feed"
+)
+
+func TestLookup(t *testing.T) {
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(`{
+  "data": {"children": [{"title": "first"}, {"title": "second", "tags": ["a", "b"]}]},
+  "count": 2,
+  "a.b": "dotted key",
+  "empty": null
+}`))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string // str of the value
+		ok   bool
+	}{
+		{"data.children.0.title", "first", true},
+		{"data.children.1.tags.1", "b", true},
+		{"count", "2", true},
+		{"empty", "", true},
+		{"data.children.2", "", false},
+		{"data.children.-1", "", false},
+		{"data.children.x", "", false},
+		{"data.missing", "", false},
+		{"count.0", "", false},
+		{"a.b", "", false},
+		{"data..children", "", false},
+	}
+	for _, test := range tests {
+		_, ok := lookup(doc, test.path)
+		if ok != test.ok {
+			t.Errorf("lookup(%q) found %v, want %v", test.path, ok, test.ok)
+		}
+		if got := str(doc, test.path); got != test.want {
+			t.Errorf("str(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+	if v, ok := lookup(doc, ""); !ok || v == nil {
+		t.Error("empty path is not the document itself")
+	}
+}
+
+func TestDate(t *testing.T) {
+	tests := []struct {
+		json string
+		want time.Time
+	}{
+		{`"2018-01-02T03:04:05Z"`, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{`" Tue, 02 Jan 2018 03:04:05 GMT "`, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{`1514862245`, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{`1514862245.9`, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{`1514862245123`, time.Date(2018, 1, 2, 3, 4, 5, 123e6, time.UTC)},
+		{`"yesterday"`, time.Time{}},
+		{`true`, time.Time{}},
+		{`null`, time.Time{}},
+	}
+	for _, test := range tests {
+		var v interface{}
+		dec := json.NewDecoder(strings.NewReader(`{"date": ` + test.json + `}`))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if got := date(v, "date"); !got.Equal(test.want) {
+			t.Errorf("date(%s) = %v, want %v", test.json, got, test.want)
+		}
+	}
+}
+
+const testDoc = `{
+  "data": {
+    "posts": [
+      {"id": 10, "title": "  Hello \n world ", "url": "/posts/10", "created": 1514862245},
+      {"id": "b", "title": "Absolute", "url": "https://example.org/b", "created": "2018-01-03T00:00:00Z"},
+      {"title": "Title only"},
+      {"id": 12, "url": "posts/12"},
+      {"id": 13},
+      "not an object"
+    ]
+  }
+}`
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://api.example.com/v1/")
+	f, err := Parse(strings.NewReader(testDoc), base, Config{
+		Items: "data.posts",
+		Title: "title",
+		Link:  "url",
+		ID:    "id",
+		Date:  "created",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "api.example.com/v1" || f.Link != base.String() {
+		t.Errorf("feed title %q link %q", f.Title, f.Link)
+	}
+	want := []*feed.Item{
+		{GUID: "10", Title: "Hello world", Link: "https://api.example.com/posts/10", Published: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{GUID: "b", Title: "Absolute", Link: "https://example.org/b", Published: time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{GUID: "sha1:693d37f4ebe69c94ba2fbc81d4dbeeec987bff12", Title: "Title only"},
+		{GUID: "12", Link: "https://api.example.com/v1/posts/12"},
+	}
+	if len(f.Items) != len(want) {
+		t.Fatalf("%d items, want %d", len(f.Items), len(want))
+	}
+	for i, w := range want {
+		g := f.Items[i]
+		if g.GUID != w.GUID || g.Title != w.Title || g.Link != w.Link || !g.Published.Equal(w.Published) {
+			t.Errorf("item %d: got %+v\nwant %+v", i, *g, *w)
+		}
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	// without an ID path the link is the GUID, the document is the array
+	f, err := Parse(strings.NewReader(`[{"link": "https://example.com/a"}]`), nil, Config{Link: "link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Items) != 1 || f.Items[0].GUID != "https://example.com/a" || f.Title != "" {
+		t.Errorf("got %q %+v", f.Title, f.Items)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		config Config
+		want   string
+	}{
+		{"no title or link", `[]`, Config{}, "title or link path is required"},
+		{"invalid path", `[]`, Config{Title: "a..b"}, `invalid title path: empty segment in "a..b"`},
+		{"missing items", testDoc, Config{Items: "data.missing", Title: "title"}, `items path "data.missing" matched nothing`},
+		{"items not an array", testDoc, Config{Items: "data", Title: "title"}, `items path "data" is not an array`},
+		{"no matching items", testDoc, Config{Items: "data.posts", Title: "name"}, `items path "data.posts" matched no items with a title or link`},
+		{"invalid JSON", `{`, Config{Title: "title"}, "unexpected EOF"},
+	}
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.doc), nil, test.config)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package message
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotMaildir is returned by MaildirFiles for directories without cur and
+// new subdirectories.
+var ErrNotMaildir = errors.New("maildir: missing cur and new directories")
+
+// MaildirFiles returns the paths of the delivered messages of a Maildir,
+// i.e. the files in cur and new. Messages still in tmp are skipped.
+func MaildirFiles(dir string) ([]string, error) {
+	var files []string
+	found := false
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, e := range entries {
+			// dot files are not messages, e.g. .DS_Store
+			if e.Mode().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(dir, sub, e.Name()))
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNotMaildir
+	}
+	sort.Strings(files)
+	return files, nil
+}
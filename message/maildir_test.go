@@ -0,0 +1,58 @@
+package message
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMaildirFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = MaildirFiles(dir); err != ErrNotMaildir {
+		t.Errorf("error %v for empty directory, want ErrNotMaildir", err)
+	}
+
+	files := []string{
+		"new/1500000002.M2P1.host",
+		"cur/1500000001.M1P1.host:2,S",
+		"cur/.DS_Store",
+		"tmp/1500000003.M3P1.host",
+	}
+	for _, f := range append(files, "cur/sub/1500000004.M4P1.host") {
+		path := filepath.Join(dir, f)
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte("Subject: test\n\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := MaildirFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// delivered messages in cur and new, without dot files, tmp and
+	// directories
+	want := []string{filepath.Join(dir, files[1]), filepath.Join(dir, files[0])}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files %q, want %q", got, want)
+	}
+
+	// new mail only
+	if err = os.RemoveAll(filepath.Join(dir, "cur")); err != nil {
+		t.Fatal(err)
+	}
+	got, err = MaildirFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = want[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("files %q without cur, want %q", got, want)
+	}
+}
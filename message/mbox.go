@@ -0,0 +1,89 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNotMbox is returned by MboxReader when the archive does not start with
+// a "From " separator line.
+var ErrNotMbox = errors.New("mbox: missing From line")
+
+// MboxReader splits an mbox archive into messages.
+//
+// Messages are separated by lines starting with "From ". Quoted From lines
+// (">From ", ">>From ", …) are unquoted by removing one ">", which handles
+// both the mboxo and mboxrd variants.
+type MboxReader struct {
+	r     *bufio.Reader
+	start bool // true until the first From line is read
+	err   error
+}
+
+// NewMboxReader returns a reader of the messages in an mbox archive.
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r), start: true}
+}
+
+// Next returns the next raw message without its From line, or io.EOF after
+// the last message.
+func (m *MboxReader) Next() ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.start {
+		m.start = false
+		line, err := m.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			m.err = io.EOF
+			return nil, m.err
+		}
+		if err != nil && err != io.EOF {
+			m.err = err
+			return nil, err
+		}
+		if !isFromLine(line) {
+			m.err = ErrNotMbox
+			return nil, m.err
+		}
+	}
+	var msg bytes.Buffer
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if isFromLine(line) {
+			break
+		}
+		if isQuotedFromLine(line) {
+			line = line[1:]
+		}
+		msg.Write(line)
+		if err == io.EOF {
+			m.err = io.EOF
+			break
+		}
+		if err != nil {
+			m.err = err
+			return nil, err
+		}
+	}
+	// the separator is preceded by an empty line that is not part of the
+	// message
+	b := msg.Bytes()
+	switch {
+	case bytes.HasSuffix(b, []byte("\r\n\r\n")):
+		b = b[:len(b)-2]
+	case bytes.HasSuffix(b, []byte("\n\n")):
+		b = b[:len(b)-1]
+	}
+	return b, nil
+}
+
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+func isQuotedFromLine(line []byte) bool {
+	return len(line) > 0 && line[0] == '>' && isFromLine(bytes.TrimLeft(line, ">"))
+}
@@ -0,0 +1,60 @@
+package message
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMboxReader(t *testing.T) {
+	tests := []struct {
+		name string
+		mbox string
+		want []string
+		err  error
+	}{
+		{
+			"messages",
+			"From a@example.com Mon Jan  1 00:00:00 2018\nSubject: 1\n\nOne\n\nFrom b@example.com Mon Jan  1 00:00:00 2018\nSubject: 2\n\nTwo\n",
+			[]string{"Subject: 1\n\nOne\n", "Subject: 2\n\nTwo\n"},
+			nil,
+		},
+		{
+			"quoted From lines",
+			"From a@example.com Mon Jan  1 00:00:00 2018\nSubject: 1\n\n>From here\n>>From there\n> From nowhere\n>Fromage\n",
+			[]string{"Subject: 1\n\nFrom here\n>From there\n> From nowhere\n>Fromage\n"},
+			nil,
+		},
+		{
+			"CRLF",
+			"From a@example.com Mon Jan  1 00:00:00 2018\r\nSubject: 1\r\n\r\nOne\r\n\r\nFrom b@example.com Mon Jan  1 00:00:00 2018\r\nSubject: 2\r\n\r\nTwo",
+			[]string{"Subject: 1\r\n\r\nOne\r\n", "Subject: 2\r\n\r\nTwo"},
+			nil,
+		},
+		{"empty", "", nil, nil},
+		{"not an mbox", "Subject: 1\n\nOne\n", nil, ErrNotMbox},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewMboxReader(strings.NewReader(test.mbox))
+			var got []string
+			for {
+				msg, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if err != test.err {
+						t.Fatalf("error %v, want %v", err, test.err)
+					}
+					break
+				}
+				got = append(got, string(msg))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("messages %q, want %q", got, test.want)
+			}
+		})
+	}
+}
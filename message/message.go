@@ -0,0 +1,171 @@
+// Package message parses e-mail messages, e.g. newsletters, into their
+// bodies and attachments.
+package message
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxDepth limits the nesting of multipart bodies.
+const maxDepth = 10
+
+// Message is a parsed e-mail message.
+type Message struct {
+	// ID is the Message-ID without angle brackets, or a hash of the
+	// message if it has none.
+	ID      string
+	From    mail.Address
+	Subject string
+	Date    time.Time // zero if unknown
+	HTML    string    // HTML body, empty if there is none
+	Text    string    // plain text body, empty if there is none
+	Parts   []Part    // attachments and inline images
+}
+
+// Part is an attachment or inline image of a message.
+type Part struct {
+	ContentType string // media type without parameters
+	Filename    string
+	ContentID   string // without angle brackets, referenced as cid: URL
+	Data        []byte
+}
+
+var decoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// Parse reads a message in RFC 5322 format.
+func Parse(r io.Reader) (*Message, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{
+		ID:      strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>"),
+		Subject: decodeHeader(msg.Header.Get("Subject")),
+	}
+	if m.ID == "" {
+		sum := sha1.Sum(raw)
+		m.ID = "sha1:" + hex.EncodeToString(sum[:])
+	}
+	from, err := (&mail.AddressParser{WordDecoder: decoder}).ParseList(msg.Header.Get("From"))
+	if err != nil || len(from) == 0 {
+		return nil, fmt.Errorf("invalid From header: %q", msg.Header.Get("From"))
+	}
+	m.From = *from[0]
+	m.From.Address = strings.ToLower(m.From.Address)
+	if d, err := msg.Header.Date(); err == nil {
+		m.Date = d.UTC()
+	}
+	err = m.walk(msg.Header, msg.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// header is the common interface of mail and MIME part headers.
+type header interface {
+	Get(key string) string
+}
+
+// walk collects the bodies and attachments of a (multi)part.
+func (m *Message) walk(h header, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth {
+			return errors.New("multipart nested too deeply")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = m.walk(p.Header, p, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	data, err := ioutil.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(dparams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+	attached := disposition == "attachment" || filename != "" && disposition != "inline"
+	switch {
+	case mediaType == "text/html" && !attached && m.HTML == "":
+		m.HTML, err = decodeCharset(params["charset"], data)
+		return err
+	case mediaType == "text/plain" && !attached && m.Text == "":
+		m.Text, err = decodeCharset(params["charset"], data)
+		return err
+	}
+	m.Parts = append(m.Parts, Part{
+		ContentType: mediaType,
+		Filename:    filename,
+		ContentID:   strings.Trim(strings.TrimSpace(h.Get("Content-Id")), "<>"),
+		Data:        data,
+	})
+	return nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+func decodeCharset(label string, data []byte) (string, error) {
+	switch strings.ToLower(label) {
+	case "", "utf-8", "us-ascii":
+		return string(data), nil
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+	if err != nil {
+		// unknown charset: better garbled than nothing
+		return string(data), nil
+	}
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func decodeHeader(s string) string {
+	d, err := decoder.DecodeHeader(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return strings.TrimSpace(d)
+}
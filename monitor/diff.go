@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// Op is the kind of change of a line.
+type Op int
+
+// Kinds of changes.
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a line of a diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells limits the size of the table used for finding the longest common
+// subsequence. Larger changes are reported as replacing all lines.
+const maxCells = 1 << 22
+
+// Diff returns the line based differences between two texts.
+func Diff(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+	// common prefix and suffix are cheap to find and usually most of a page
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	var diff []Line
+	for _, l := range x[:pre] {
+		diff = append(diff, Line{Equal, l})
+	}
+	diff = append(diff, lcsDiff(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+	for _, l := range x[len(x)-suf:] {
+		diff = append(diff, Line{Equal, l})
+	}
+	return diff
+}
+
+// lcsDiff compares lines using the longest common subsequence.
+func lcsDiff(x, y []string) []Line {
+	var diff []Line
+	if len(x)*len(y) > maxCells {
+		for _, l := range x {
+			diff = append(diff, Line{Delete, l})
+		}
+		for _, l := range y {
+			diff = append(diff, Line{Insert, l})
+		}
+		return diff
+	}
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			diff = append(diff, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, Line{Delete, x[i]})
+			i++
+		default:
+			diff = append(diff, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		diff = append(diff, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		diff = append(diff, Line{Insert, y[j]})
+	}
+	return diff
+}
+
+// Count returns the amount of inserted and deleted lines.
+func Count(diff []Line) (inserted, deleted int) {
+	for _, l := range diff {
+		switch l.Op {
+		case Insert:
+			inserted++
+		case Delete:
+			deleted++
+		}
+	}
+	return inserted, deleted
+}
+
+// HTML renders the changed lines of a diff as a <pre> element, with up to
+// context unchanged lines around each change. Inserted lines are wrapped in
+// <ins>, deleted lines in <del>.
+func HTML(diff []Line, context int) string {
+	// keep lines that are close enough to a change
+	keep := make([]bool, len(diff))
+	for i, l := range diff {
+		if l.Op == Equal {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(diff) {
+				keep[j] = true
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("<pre>")
+	skipped := false
+	for i, l := range diff {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			buf.WriteString("…\n")
+			skipped = false
+		}
+		text := html.EscapeString(l.Text)
+		switch l.Op {
+		case Insert:
+			buf.WriteString("<ins>+ " + text + "</ins>\n")
+		case Delete:
+			buf.WriteString("<del>- " + text + "</del>\n")
+		default:
+			buf.WriteString("  " + text + "\n")
+		}
+	}
+	if skipped {
+		buf.WriteString("…\n")
+	}
+	buf.WriteString("</pre>")
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
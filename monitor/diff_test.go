@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"unchanged", "a\nb\nc", "a\nb\nc", []Line{{Equal, "a"}, {Equal, "b"}, {Equal, "c"}}},
+		{"both empty", "", "", nil},
+		{"from empty", "", "a\nb", []Line{{Insert, "a"}, {Insert, "b"}}},
+		{"to empty", "a\nb", "", []Line{{Delete, "a"}, {Delete, "b"}}},
+		{"insert at start", "b\nc", "a\nb\nc", []Line{{Insert, "a"}, {Equal, "b"}, {Equal, "c"}}},
+		{"insert in middle", "a\nc", "a\nb\nc", []Line{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}}},
+		{"insert at end", "a\nb", "a\nb\nc", []Line{{Equal, "a"}, {Equal, "b"}, {Insert, "c"}}},
+		{"delete", "a\nb\nc", "a\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}}},
+		{"replace", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{
+			"common lines between changes",
+			"a\nb\nc\nd\ne",
+			"a\nx\nc\ne\ny",
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}, {Delete, "d"}, {Equal, "e"}, {Insert, "y"}},
+		},
+		{
+			"moved line",
+			"a\nb\nc",
+			"b\nc\na",
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(test.a, test.b)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got  %v\nwant %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffOversized(t *testing.T) {
+	// the changed lines in between the common prefix and suffix exceed
+	// maxCells, so the shared line is not found and everything is replaced
+	n := 2100
+	if n*n <= maxCells {
+		t.Fatalf("%d lines fit into maxCells", n)
+	}
+	var x, y []string
+	for i := 0; i < n; i++ {
+		x = append(x, fmt.Sprintf("x%d", i))
+		y = append(y, fmt.Sprintf("y%d", i))
+	}
+	a := "prefix\n" + strings.Join(x, "\n") + "\nshared\nsuffix"
+	b := "prefix\nshared\n" + strings.Join(y, "\n") + "\nsuffix"
+	diff := Diff(a, b)
+	if ins, del := Count(diff); ins != n+1 || del != n+1 {
+		t.Errorf("%d inserted and %d deleted lines, want %d each", ins, del, n+1)
+	}
+	if diff[0] != (Line{Equal, "prefix"}) || diff[len(diff)-1] != (Line{Equal, "suffix"}) {
+		t.Errorf("common prefix or suffix not kept: %v %v", diff[0], diff[len(diff)-1])
+	}
+	if diff[n+1] != (Line{Delete, "shared"}) || diff[n+2] != (Line{Insert, "shared"}) {
+		t.Errorf("shared line %v %v, want deleted and inserted", diff[n+1], diff[n+2])
+	}
+}
+
+func TestCount(t *testing.T) {
+	ins, del := Count(Diff("a\nb\nc", "a\nx\ny\nc"))
+	if ins != 2 || del != 1 {
+		t.Errorf("Count = %d, %d, want 2, 1", ins, del)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8"
+	b := "1\n2\n3\n<4>\n5\n6\n7\n8"
+	want := "<pre>…\n  3\n<del>- 4</del>\n<ins>+ &lt;4&gt;</ins>\n  5\n…\n</pre>"
+	if got := HTML(Diff(a, b), 1); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
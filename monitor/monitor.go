@@ -0,0 +1,134 @@
+// Package monitor turns web pages into normalized text snapshots and
+// describes the changes between two snapshots.
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Snapshot is the normalized text of a page.
+type Snapshot struct {
+	Title string // title of the page
+	Text  string // one line per block of text
+}
+
+// ignored elements contain no visible text.
+var ignored = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Noscript: true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+}
+
+// inline elements do not start a new line.
+var inline = map[atom.Atom]bool{
+	atom.A:      true,
+	atom.Abbr:   true,
+	atom.B:      true,
+	atom.Cite:   true,
+	atom.Code:   true,
+	atom.Em:     true,
+	atom.I:      true,
+	atom.Kbd:    true,
+	atom.Label:  true,
+	atom.Mark:   true,
+	atom.Q:      true,
+	atom.S:      true,
+	atom.Small:  true,
+	atom.Span:   true,
+	atom.Strong: true,
+	atom.Sub:    true,
+	atom.Sup:    true,
+	atom.Time:   true,
+	atom.U:      true,
+}
+
+// Take reads a HTML page and returns the text of all elements matching
+// selector, or the whole body if selector is empty. contentType is used to
+// detect the charset and may be empty.
+//
+// White space is collapsed and block elements are put on separate lines, so
+// that changes to the markup alone do not change the snapshot.
+func Take(r io.Reader, contentType, selector string) (*Snapshot, error) {
+	var sel cascadia.Matcher = cascadia.MustCompile("body")
+	if selector != "" {
+		var err error
+		sel, err = cascadia.ParseGroup(selector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if t := cascadia.Query(doc, cascadia.MustCompile("title")); t != nil && t.FirstChild != nil {
+		s.Title = strings.Join(strings.Fields(t.FirstChild.Data), " ")
+	}
+	nodes := cascadia.QueryAll(doc, sel)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("selector %q matched nothing", selector)
+	}
+	w := &textWriter{}
+	for _, n := range nodes {
+		w.walk(n)
+		w.newline()
+	}
+	s.Text = strings.Join(w.lines, "\n")
+	return s, nil
+}
+
+// textWriter collects lines of normalized text.
+type textWriter struct {
+	lines []string
+	line  strings.Builder
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.line.WriteString(n.Data)
+		w.line.WriteByte(' ')
+		return
+	case html.ElementNode:
+		if ignored[n.DataAtom] {
+			return
+		}
+		if n.DataAtom == atom.Br {
+			w.newline()
+			return
+		}
+	}
+	block := n.Type == html.ElementNode && !inline[n.DataAtom]
+	if block {
+		w.newline()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if block {
+		w.newline()
+	}
+}
+
+// newline ends the current line unless it's empty.
+func (w *textWriter) newline() {
+	line := strings.Join(strings.Fields(w.line.String()), " ")
+	w.line.Reset()
+	if line != "" {
+		w.lines = append(w.lines, line)
+	}
+}
@@ -0,0 +1,211 @@
+// Package opml reads and writes OPML 1.0 and 2.0 subscription lists.
+//
+// Outlines with a feed URL are subscriptions. The texts of the outlines
+// they are nested in and their categories become tags, so folders of other
+// readers map to tags.
+package opml
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Subscription is a feed of an OPML document.
+type Subscription struct {
+	Title   string
+	FeedURL string
+	SiteURL string
+	Tags    []string // sorted and unique
+}
+
+// document is an OPML document.
+//
+// See http://opml.org/spec2.opml
+type document struct {
+	XMLName xml.Name  `xml:"opml"`
+	Version string    `xml:"version,attr"`
+	Title   string    `xml:"head>title"`
+	Created string    `xml:"head>dateCreated,omitempty"`
+	Body    []outline `xml:"body>outline"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Category string    `xml:"category,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler. Attribute names are matched
+// case-insensitively as exporters disagree on e.g. xmlUrl and xmlURL.
+func (o *outline) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, a := range start.Attr {
+		switch strings.ToLower(a.Name.Local) {
+		case "text":
+			o.Text = a.Value
+		case "title":
+			o.Title = a.Value
+		case "type":
+			o.Type = a.Value
+		case "xmlurl":
+			o.XMLURL = a.Value
+		case "htmlurl":
+			o.HTMLURL = a.Value
+		case "category":
+			o.Category = a.Value
+		}
+	}
+	var children struct {
+		Outlines []outline `xml:"outline"`
+	}
+	err := d.DecodeElement(&children, &start)
+	o.Outlines = children.Outlines
+	return err
+}
+
+// Parse returns the subscriptions of an OPML document in document order.
+// Outlines of the same feed URL are merged.
+func Parse(r io.Reader) ([]Subscription, error) {
+	doc := &document{}
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	err := d.Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{index: make(map[string]int)}
+	p.walk(doc.Body, nil)
+	for i := range p.subs {
+		p.subs[i].Tags = uniqueTags(p.subs[i].Tags)
+	}
+	return p.subs, nil
+}
+
+type parser struct {
+	subs  []Subscription
+	index map[string]int // position of a feed URL in subs
+}
+
+func (p *parser) walk(outlines []outline, parents []string) {
+	for _, o := range outlines {
+		text := strings.TrimSpace(o.Text)
+		if text == "" {
+			text = strings.TrimSpace(o.Title)
+		}
+		link := strings.TrimSpace(o.XMLURL)
+		if link == "" {
+			if text != "" {
+				// copy to keep siblings from sharing the backing array
+				tags := append(append([]string(nil), parents...), text)
+				p.walk(o.Outlines, tags)
+			} else {
+				p.walk(o.Outlines, parents)
+			}
+			continue
+		}
+		tags := append(append([]string(nil), parents...), splitCategory(o.Category)...)
+		i, ok := p.index[link]
+		if !ok {
+			p.index[link] = len(p.subs)
+			p.subs = append(p.subs, Subscription{
+				Title:   text,
+				FeedURL: link,
+				SiteURL: strings.TrimSpace(o.HTMLURL),
+				Tags:    tags,
+			})
+		} else {
+			p.subs[i].Tags = append(p.subs[i].Tags, tags...)
+		}
+		// subscriptions are not folders, but nested outlines are kept
+		p.walk(o.Outlines, parents)
+	}
+}
+
+// splitCategory returns the categories of a comma separated list of slash
+// delimited category paths, e.g. "/Tech/Go,News" becomes "Tech/Go" and
+// "News".
+func splitCategory(s string) []string {
+	var cats []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.Trim(strings.TrimSpace(c), "/")
+		if c != "" {
+			cats = append(cats, c)
+		}
+	}
+	return cats
+}
+
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, t := range tags {
+		t = strings.Join(strings.Fields(t), " ")
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		unique = append(unique, t)
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// Write writes subscriptions as OPML 2.0 document. A subscription is nested
+// in an outline of its first tag and all of its tags are listed as
+// categories.
+func Write(w io.Writer, title string, subs []Subscription, now time.Time) error {
+	doc := &document{
+		Version: "2.0",
+		Title:   title,
+		Created: now.UTC().Format(time.RFC1123Z),
+	}
+	folders := make(map[string]int) // position of a tag outline in doc.Body
+	for _, s := range subs {
+		o := outline{
+			Text:    s.Title,
+			Title:   s.Title,
+			Type:    "rss",
+			XMLURL:  s.FeedURL,
+			HTMLURL: s.SiteURL,
+		}
+		if o.Text == "" {
+			o.Text = s.FeedURL
+		}
+		if len(s.Tags) == 0 {
+			doc.Body = append(doc.Body, o)
+			continue
+		}
+		cats := make([]string, len(s.Tags))
+		for i, t := range s.Tags {
+			cats[i] = "/" + t
+		}
+		o.Category = strings.Join(cats, ",")
+		i, ok := folders[s.Tags[0]]
+		if !ok {
+			i = len(doc.Body)
+			folders[s.Tags[0]] = i
+			doc.Body = append(doc.Body, outline{Text: s.Tags[0]})
+		}
+		doc.Body[i].Outlines = append(doc.Body[i].Outlines, o)
+	}
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,133 @@
+package opml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		opml string
+		want []Subscription
+	}{
+		{
+			"OPML 1.0",
+			`<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="1.0">
+<head><title>Subscriptions</title></head>
+<body>
+<outline text="Caf` + "\xe9" + `" type="rss" xmlUrl="https://example.com/feed" htmlUrl="https://example.com/"/>
+<outline title="Only title" xmlUrl="https://example.org/feed"/>
+</body>
+</opml>`,
+			[]Subscription{
+				{Title: "Café", FeedURL: "https://example.com/feed", SiteURL: "https://example.com/"},
+				{Title: "Only title", FeedURL: "https://example.org/feed"},
+			},
+		},
+		{
+			"OPML 2.0 with nested folders",
+			`<opml version="2.0">
+<head><title>Subscriptions</title></head>
+<body>
+<outline text="Tech">
+  <outline text="Go">
+    <outline text="Go blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+  </outline>
+  <outline text="Rust blog" type="rss" xmlUrl="https://blog.rust-lang.org/feed.xml"/>
+</outline>
+<outline text="">
+  <outline text="Untitled folder" type="rss" xmlUrl="https://example.net/feed"/>
+</outline>
+</body>
+</opml>`,
+			[]Subscription{
+				{Title: "Go blog", FeedURL: "https://go.dev/blog/feed.atom", Tags: []string{"Go", "Tech"}},
+				{Title: "Rust blog", FeedURL: "https://blog.rust-lang.org/feed.xml", Tags: []string{"Tech"}},
+				{Title: "Untitled folder", FeedURL: "https://example.net/feed"},
+			},
+		},
+		{
+			"attribute case",
+			`<opml version="2.0"><body>
+<outline text="Upper" XMLURL="https://example.com/upper" HTMLURL="https://example.com/"/>
+<outline text="Mixed" xmlURL="https://example.com/mixed"/>
+</body></opml>`,
+			[]Subscription{
+				{Title: "Upper", FeedURL: "https://example.com/upper", SiteURL: "https://example.com/"},
+				{Title: "Mixed", FeedURL: "https://example.com/mixed"},
+			},
+		},
+		{
+			"same feed in two folders",
+			`<opml version="2.0"><body>
+<outline text="News"><outline text="Daily" xmlUrl="https://example.com/feed"/></outline>
+<outline text="Favourites"><outline text="Daily copy" xmlUrl=" https://example.com/feed "/></outline>
+<outline text="News"><outline text="Daily" xmlUrl="https://example.com/feed"/></outline>
+</body></opml>`,
+			[]Subscription{
+				{Title: "Daily", FeedURL: "https://example.com/feed", Tags: []string{"Favourites", "News"}},
+			},
+		},
+		{
+			"categories",
+			`<opml version="2.0"><body>
+<outline text="Folder">
+  <outline text="Feed" xmlUrl="https://example.com/feed" category="/Tech/Go, News,/,Folder"/>
+</outline>
+</body></opml>`,
+			[]Subscription{
+				{Title: "Feed", FeedURL: "https://example.com/feed", Tags: []string{"Folder", "News", "Tech/Go"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(test.opml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<opml version="2.0"><body><outline`))
+	if err == nil {
+		t.Error("no error for truncated document")
+	}
+}
+
+func TestWriteParse(t *testing.T) {
+	subs := []Subscription{
+		{Title: "Go blog", FeedURL: "https://go.dev/blog/feed.atom", SiteURL: "https://go.dev/blog", Tags: []string{"Go", "Tech"}},
+		{Title: "Untagged", FeedURL: "https://example.com/feed?a=1&b=2"},
+		{Title: "Rust <blog>", FeedURL: "https://blog.rust-lang.org/feed.xml", Tags: []string{"Tech"}},
+		{Title: "Go wiki", FeedURL: "https://go.dev/wiki/feed", Tags: []string{"Go"}},
+		{Title: "Nested category", FeedURL: "https://example.org/feed", Tags: []string{"Tech/Go"}},
+	}
+	buf := &bytes.Buffer{}
+	err := Write(buf, "rssd subscriptions", subs, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<dateCreated>Tue, 02 Jan 2018 03:04:05 +0000</dateCreated>`) {
+		t.Errorf("missing creation date:\n%s", buf)
+	}
+	got, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// subscriptions are grouped by their first tag
+	want := []Subscription{subs[0], subs[3], subs[1], subs[2], subs[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,280 @@
+// Package sanitize cleans untrusted HTML of feed items so it can be embedded
+// in pages of rssd.
+//
+// Only an allow-list of elements and attributes is kept. Scripts, styles,
+// event handlers and URLs other than http, https and mailto are removed.
+package sanitize
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Version is increased whenever the rules change, so that stored content can
+// be sanitized again.
+const Version = 1
+
+// elements maps allowed elements to their allowed attributes. Elements that
+// are not listed are replaced by their content.
+var elements = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.Audio:      {"src", "controls"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Del:        {"cite", "datetime"},
+	atom.Details:    nil,
+	atom.Dfn:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Iframe:     {"src", "width", "height", "allowfullscreen"},
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        {"cite", "datetime"},
+	atom.Kbd:        nil,
+	atom.Li:         {"value"},
+	atom.Mark:       nil,
+	atom.Ol:         {"start", "type", "reversed"},
+	atom.P:          nil,
+	atom.Picture:    nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Small:      nil,
+	atom.Source:     {"src", "type"},
+	atom.Span:       nil,
+	atom.Strike:     nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan", "scope"},
+	atom.Thead:      nil,
+	atom.Time:       {"datetime"},
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+	atom.Video:      {"src", "poster", "controls", "width", "height"},
+}
+
+// dropped elements are removed including their content.
+var dropped = map[atom.Atom]bool{
+	atom.Applet:   true,
+	atom.Base:     true,
+	atom.Button:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Head:     true,
+	atom.Input:    true,
+	atom.Link:     true,
+	atom.Math:     true,
+	atom.Meta:     true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+}
+
+// urlAttrs are attributes containing a URL.
+var urlAttrs = map[string]bool{
+	"cite":   true,
+	"href":   true,
+	"poster": true,
+	"src":    true,
+}
+
+// iframeHosts are the hosts of video players that may be embedded.
+var iframeHosts = map[string]bool{
+	"www.youtube.com":          true,
+	"youtube.com":              true,
+	"www.youtube-nocookie.com": true,
+	"player.vimeo.com":         true,
+	"www.dailymotion.com":      true,
+}
+
+// HTML returns a safe version of the HTML fragment s. Relative URLs are
+// resolved against base, usually the link of the item. If base is a path
+// like "/", they are resolved to paths on the server showing the fragment.
+// Relative URLs are removed if base is nil.
+func HTML(s string, base *url.URL) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), body)
+	if err != nil {
+		// the parser is lenient and only fails on read errors
+		return html.EscapeString(s)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	clean(body, base)
+	buf := &bytes.Buffer{}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(buf, c)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// clean the children of n recursively.
+func clean(n *html.Node, base *url.URL) {
+	c := n.FirstChild
+	for c != nil {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			attrs, ok := elements[c.DataAtom]
+			switch {
+			case dropped[c.DataAtom]:
+				n.RemoveChild(c)
+			case !ok:
+				// unwrap unknown elements and clean their children instead
+				first := c.FirstChild
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+				if first != nil {
+					next = first
+				}
+			default:
+				c.Attr = cleanAttrs(c, attrs, base)
+				if !valid(c) {
+					n.RemoveChild(c)
+					break
+				}
+				if c.DataAtom == atom.A {
+					c.Attr = append(c.Attr, html.Attribute{Key: "rel", Val: "nofollow noopener noreferrer"})
+				}
+				if c.DataAtom == atom.Iframe {
+					c.Attr = append(c.Attr, html.Attribute{Key: "sandbox", Val: "allow-scripts allow-same-origin allow-popups"})
+					// fallback content is raw text that would be rendered
+					// unescaped
+					for c.FirstChild != nil {
+						c.RemoveChild(c.FirstChild)
+					}
+				}
+				clean(c, base)
+			}
+		default:
+			// comments and doctypes
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// cleanAttrs returns the allowed attributes of n with URLs resolved against
+// base. Attributes with unsafe URLs are removed.
+func cleanAttrs(n *html.Node, allowed []string, base *url.URL) []html.Attribute {
+	var attrs []html.Attribute
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		if urlAttrs[a.Key] {
+			u, ok := safeURL(a.Val, base, a.Key == "href")
+			if !ok {
+				continue
+			}
+			a.Val = u
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// valid returns false if an element is useless or unsafe with its cleaned
+// attributes.
+func valid(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Img:
+		return attr(n, "src") != ""
+	case atom.Iframe:
+		u, err := url.Parse(attr(n, "src"))
+		return err == nil && u.Scheme == "https" && iframeHosts[strings.ToLower(u.Host)]
+	}
+	return true
+}
+
+// safeURL resolves a URL against base and returns it if it's http, https,
+// a path if base is one or, if mailto is true, a mailto link.
+func safeURL(raw string, base *url.URL, mailto bool) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme == "" && u.Host != "" {
+		// prefer https for protocol relative URLs
+		u.Scheme = "https"
+	}
+	if !u.IsAbs() {
+		if base == nil {
+			return "", false
+		}
+		u = base.ResolveReference(u)
+		if !base.IsAbs() {
+			return u.String(), u.Host == "" && strings.HasPrefix(u.Path, "/")
+		}
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), mailto
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package sanitize
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", " \n ", ""},
+		{"text", "a < b & c", "a &lt; b &amp; c"},
+		{"script", `<p>a</p><script>alert(1)</script><p>b</p>`, `<p>a</p><p>b</p>`},
+		{"style", `<style>p { color: red }</style><p style="color: red">a</p>`, `<p>a</p>`},
+		{"event handlers", `<img src="/a.png" onerror="alert(1)" onload=alert(2)><p onclick="alert(3)">a</p>`, `<img src="https://example.com/a.png"/><p>a</p>`},
+		{"unknown elements are unwrapped", `<custom><b>bold</b></custom>`, `<b>bold</b>`},
+		{"comments", `a<!-- <script>alert(1)</script> -->b`, `ab`},
+		{"javascript href", `<a href="javascript:alert(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript mixed case", `<a href="JaVaScRiPt:alert(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript leading whitespace", `<a href=" 	javascript:alert(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript with tab", "<a href=\"java\tscript:alert(1)\">a</a>", `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript with entity", `<a href="java&#x09;script:alert(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript with newline", "<a href=\"java\nscript:alert(1)\">a</a>", `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"javascript src", `<img src="javascript:alert(1)"><iframe src="javascript:alert(1)"></iframe>`, ``},
+		{"data src", `<img src="data:image/svg+xml;base64,PHN2Zz4=">`, ``},
+		{"data href", `<a href="DATA:text/html,<script>alert(1)</script>">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"vbscript", `<a href="vbscript:msgbox(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{"mailto href", `<a href="mailto:a@example.com">a</a>`, `<a href="mailto:a@example.com" rel="nofollow noopener noreferrer">a</a>`},
+		{"mailto src", `<img src="mailto:a@example.com"><blockquote cite="mailto:a@example.com">q</blockquote>`, `<blockquote>q</blockquote>`},
+		{"rel is replaced", `<a href="https://example.org/" rel="opener" target="_blank">a</a>`, `<a href="https://example.org/" rel="nofollow noopener noreferrer">a</a>`},
+		{"relative", `<a href="../about">a</a><img src="img/a.png">`, `<a href="https://example.com/about" rel="nofollow noopener noreferrer">a</a><img src="https://example.com/blog/img/a.png"/>`},
+		{"root relative", `<a href="/about?x=1#top">a</a>`, `<a href="https://example.com/about?x=1#top" rel="nofollow noopener noreferrer">a</a>`},
+		{"protocol relative", `<img src="//cdn.example.org/a.png">`, `<img src="https://cdn.example.org/a.png"/>`},
+		{"iframe", `<iframe src="https://www.youtube.com/embed/x" width="560" onload="alert(1)">fallback <b>x</b></iframe>`, `<iframe src="https://www.youtube.com/embed/x" width="560" sandbox="allow-scripts allow-same-origin allow-popups"></iframe>`},
+		{"iframe host case", `<iframe src="https://Player.Vimeo.com/video/1"></iframe>`, `<iframe src="https://Player.Vimeo.com/video/1" sandbox="allow-scripts allow-same-origin allow-popups"></iframe>`},
+		{"iframe other host", `<iframe src="https://evil.example.com/embed"></iframe>`, ``},
+		{"iframe without https", `<iframe src="http://www.youtube.com/embed/x"></iframe>`, ``},
+		{"iframe lookalike host", `<iframe src="https://www.youtube.com.evil.example/embed"></iframe>`, ``},
+		{"iframe sandbox is replaced", `<iframe src="https://www.youtube.com/embed/x" sandbox="allow-top-navigation"></iframe>`, `<iframe src="https://www.youtube.com/embed/x" sandbox="allow-scripts allow-same-origin allow-popups"></iframe>`},
+		{"forms", `<form action="/x"><input name="a"><button>b</button></form>after`, `after`},
+		{"svg", `<svg><script>alert(1)</script></svg>after`, `after`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := HTML(test.in, base); got != test.want {
+				t.Errorf("HTML(%q)\n got %q\nwant %q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHTMLWithoutBase(t *testing.T) {
+	in := `<a href="/about">a</a><img src="img/a.png"><img src="https://example.com/b.png">`
+	want := `<a rel="nofollow noopener noreferrer">a</a><img src="https://example.com/b.png"/>`
+	if got := HTML(in, nil); got != want {
+		t.Errorf("HTML(%q, nil)\n got %q\nwant %q", in, got, want)
+	}
+}
+
+func TestHTMLPathBase(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`<img src="/attachments/1/a.png">`, `<img src="/attachments/1/a.png"/>`},
+		{`<img src="attachments/1/a.png">`, `<img src="/attachments/1/a.png"/>`},
+		{`<a href="https://example.com/">a</a>`, `<a href="https://example.com/" rel="nofollow noopener noreferrer">a</a>`},
+		{`<img src="//example.com/a.png">`, `<img src="https://example.com/a.png"/>`},
+		{`<a href="javascript:alert(1)">a</a>`, `<a rel="nofollow noopener noreferrer">a</a>`},
+		{`<img src="data:image/png;base64,AAAA">`, ``},
+	}
+	for _, test := range tests {
+		if got := HTML(test.in, &url.URL{Path: "/"}); got != test.want {
+			t.Errorf("HTML(%q, /)\n got %q\nwant %q", test.in, got, test.want)
+		}
+	}
+}
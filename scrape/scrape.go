@@ -0,0 +1,209 @@
+// Package scrape creates feeds from web pages that have none, using CSS
+// selectors to find the items of a page.
+package scrape
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/nochso/rss/feed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Config selects the items of a page. All selectors but Item are relative
+// to an item and optional.
+type Config struct {
+	// Item selects the container of each item.
+	Item string
+	// Title selects the title. Defaults to the text of the link.
+	Title string
+	// Link selects the link, either an element with href or one containing
+	// a link. Defaults to the first link of the item.
+	Link string
+	// Date selects the publication date: the datetime attribute of a
+	// <time> element or the text of any other element.
+	Date string
+}
+
+// Validate returns an error if any of the selectors is invalid.
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.Item) == "" {
+		return fmt.Errorf("item selector is required")
+	}
+	for _, s := range []struct{ name, sel string }{
+		{"item", c.Item},
+		{"title", c.Title},
+		{"link", c.Link},
+		{"date", c.Date},
+	} {
+		if s.sel == "" {
+			continue
+		}
+		if _, err := cascadia.ParseGroup(s.sel); err != nil {
+			return fmt.Errorf("invalid %s selector: %v", s.name, err)
+		}
+	}
+	return nil
+}
+
+// Parser returns a function with the signature of feed.Parse that scrapes
+// pages using c.
+func (c Config) Parser() func(io.Reader, string, *url.URL) (*feed.Feed, error) {
+	return func(r io.Reader, contentType string, base *url.URL) (*feed.Feed, error) {
+		return Parse(r, contentType, base, c)
+	}
+}
+
+// Parse reads a HTML page and returns a feed of the items selected by c.
+// contentType is used to detect the charset and may be empty. Relative links
+// are resolved against base.
+//
+// Items without title and link are skipped. The GUID of an item is its link,
+// or a hash of its title if it has none.
+func Parse(r io.Reader, contentType string, base *url.URL, c Config) (*feed.Feed, error) {
+	sel, err := compile(c)
+	if err != nil {
+		return nil, err
+	}
+	r, err = charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &feed.Feed{}
+	if t := cascadia.Query(doc, cascadia.MustCompile("title")); t != nil {
+		f.Title = feed.CollapseSpace(text(t))
+	}
+	if base != nil {
+		f.Link = base.String()
+	}
+	for _, n := range cascadia.QueryAll(doc, sel.item) {
+		item := &feed.Item{}
+		link := first(n, sel.link)
+		if link != nil && attr(link, "href") == "" {
+			link = cascadia.Query(link, aHref)
+		}
+		if link != nil {
+			item.Link = resolve(base, attr(link, "href"))
+		}
+		switch {
+		case sel.title != nil:
+			if t := first(n, sel.title); t != nil {
+				item.Title = feed.CollapseSpace(text(t))
+			}
+		case link != nil:
+			item.Title = feed.CollapseSpace(text(link))
+		}
+		if sel.date != nil {
+			if d := first(n, sel.date); d != nil {
+				s := attr(d, "datetime")
+				if d.DataAtom != atom.Time || s == "" {
+					s = text(d)
+				}
+				item.Published = feed.ParseDate(feed.CollapseSpace(s))
+			}
+		}
+		if item.Title == "" && item.Link == "" {
+			continue
+		}
+		item.GUID = item.Link
+		if item.GUID == "" {
+			sum := sha1.Sum([]byte(item.Title))
+			item.GUID = "sha1:" + hex.EncodeToString(sum[:])
+		}
+		f.Items = append(f.Items, item)
+	}
+	if len(f.Items) == 0 {
+		return nil, fmt.Errorf("item selector %q matched no items", c.Item)
+	}
+	return f, nil
+}
+
+// aHref selects links.
+var aHref = cascadia.MustCompile("a[href]")
+
+type selectors struct {
+	item, title, link, date cascadia.Matcher
+}
+
+func compile(c Config) (selectors, error) {
+	var s selectors
+	var err error
+	s.item, err = cascadia.ParseGroup(c.Item)
+	if err != nil {
+		return s, err
+	}
+	s.link = aHref
+	for _, opt := range []struct {
+		sel string
+		m   *cascadia.Matcher
+	}{
+		{c.Title, &s.title},
+		{c.Link, &s.link},
+		{c.Date, &s.date},
+	} {
+		if opt.sel == "" {
+			continue
+		}
+		*opt.m, err = cascadia.ParseGroup(opt.sel)
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// first returns n itself if it matches m, otherwise its first matching
+// descendant.
+func first(n *html.Node, m cascadia.Matcher) *html.Node {
+	if m.Match(n) {
+		return n
+	}
+	return cascadia.Query(n, m)
+}
+
+func resolve(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || base == nil {
+		return href
+	}
+	u, err := base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
+
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
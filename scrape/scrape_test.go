@@ -0,0 +1,163 @@
+package scrape
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nochso/rss/feed"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>
+  Job   board
+</title></head><body>
+<div class="job">
+  <h2><a href="/jobs/1">Go  developer</a></h2>
+  <p class="summary"><a href="https://example.org/company">Company</a></p>
+  <time datetime="2018-01-02T10:00:00Z">two days ago</time>
+  <span class="posted">Tue, 02 Jan 2018 10:00:00 GMT</span>
+</div>
+<div class="job">
+  <h2>No link</h2>
+  <span class="posted"> 3 Jan 2018 </span>
+  <time>Jan 3</time>
+</div>
+<div class="job">
+  <h2><a href="jobs/3?ref=list&amp;x=1"> Relative </a></h2>
+  <span class="posted">yesterday</span>
+</div>
+<div class="job"><p>neither title nor link</p></div>
+<div class="job" id="self-link"><a href="../up">Up</a></div>
+</body></html>`
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/board/index.html")
+	jan2 := time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC)
+	jan3 := time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		config Config
+		want   []*feed.Item
+	}{
+		{
+			"first link",
+			Config{Item: "div.job"},
+			[]*feed.Item{
+				{GUID: "https://example.com/jobs/1", Title: "Go developer", Link: "https://example.com/jobs/1"},
+				{GUID: "https://example.com/board/jobs/3?ref=list&x=1", Title: "Relative", Link: "https://example.com/board/jobs/3?ref=list&x=1"},
+				{GUID: "https://example.com/up", Title: "Up", Link: "https://example.com/up"},
+			},
+		},
+		{
+			"title and link selectors",
+			Config{Item: "div.job", Title: "h2", Link: ".summary"},
+			[]*feed.Item{
+				{GUID: "https://example.org/company", Title: "Go developer", Link: "https://example.org/company"},
+				{GUID: "sha1:fb997f45c8135520e60b6b34678c161ebb9f7daa", Title: "No link"},
+				{GUID: "sha1:979b63354f43dac53577a66d5b5f7d9f123bb841", Title: "Relative"},
+			},
+		},
+		{
+			"item is the link",
+			Config{Item: "div.job h2 a, #self-link a"},
+			[]*feed.Item{
+				{GUID: "https://example.com/jobs/1", Title: "Go developer", Link: "https://example.com/jobs/1"},
+				{GUID: "https://example.com/board/jobs/3?ref=list&x=1", Title: "Relative", Link: "https://example.com/board/jobs/3?ref=list&x=1"},
+				{GUID: "https://example.com/up", Title: "Up", Link: "https://example.com/up"},
+			},
+		},
+		{
+			"time element",
+			Config{Item: "div.job", Title: "h2", Date: "time"},
+			[]*feed.Item{
+				// the datetime attribute is preferred over the text
+				{GUID: "https://example.com/jobs/1", Title: "Go developer", Link: "https://example.com/jobs/1", Published: jan2},
+				{GUID: "sha1:fb997f45c8135520e60b6b34678c161ebb9f7daa", Title: "No link"},
+				{GUID: "https://example.com/board/jobs/3?ref=list&x=1", Title: "Relative", Link: "https://example.com/board/jobs/3?ref=list&x=1"},
+				{GUID: "https://example.com/up", Link: "https://example.com/up"},
+			},
+		},
+		{
+			"date text",
+			Config{Item: "div.job", Title: "h2", Date: ".posted"},
+			[]*feed.Item{
+				{GUID: "https://example.com/jobs/1", Title: "Go developer", Link: "https://example.com/jobs/1", Published: jan2},
+				{GUID: "sha1:fb997f45c8135520e60b6b34678c161ebb9f7daa", Title: "No link", Published: jan3},
+				{GUID: "https://example.com/board/jobs/3?ref=list&x=1", Title: "Relative", Link: "https://example.com/board/jobs/3?ref=list&x=1"},
+				{GUID: "https://example.com/up", Link: "https://example.com/up"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(testPage), "text/html; charset=utf-8", base, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Title != "Job board" || f.Link != base.String() {
+				t.Errorf("feed title %q link %q", f.Title, f.Link)
+			}
+			if got, want := items(f.Items), items(test.want); got != want {
+				t.Errorf("items\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseCharset(t *testing.T) {
+	page := "<title>Caf\xe9</title><ul><li><a href=\"/a\">Men\xfc</a></li></ul>"
+	f, err := Parse(strings.NewReader(page), "text/html; charset=iso-8859-1", nil, Config{Item: "li"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "Caf\u00e9" || len(f.Items) != 1 || f.Items[0].Title != "Men\u00fc" || f.Items[0].Link != "/a" {
+		t.Errorf("got %q %s", f.Title, items(f.Items))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"no items", Config{Item: "article"}, `item selector "article" matched no items`},
+		{"invalid selector", Config{Item: "div.job", Date: "[["}, ""},
+	}
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(testPage), "", nil, test.config)
+		if err == nil || test.want != "" && err.Error() != test.want {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{Config{Item: "div.job", Title: "h2", Link: "a", Date: "time"}, ""},
+		{Config{Item: " "}, "item selector is required"},
+		{Config{Item: "div.job", Title: "h2 >"}, "invalid title selector"},
+		{Config{Item: "div.job", Link: ":nope"}, "invalid link selector"},
+		{Config{Item: "div.job", Date: "[["}, "invalid date selector"},
+	}
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.HasPrefix(err.Error(), test.want)) {
+			t.Errorf("Validate(%+v) = %v, want %q", test.config, err, test.want)
+		}
+	}
+}
+
+// items formats the compared fields of items one per line.
+func items(items []*feed.Item) string {
+	var s []string
+	for _, it := range items {
+		s = append(s, it.GUID+" | "+it.Title+" | "+it.Link+" | "+it.Published.Format(time.RFC3339))
+	}
+	return strings.Join(s, "\n")
+}
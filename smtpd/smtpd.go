@@ -0,0 +1,487 @@
+// Package smtpd implements a minimal SMTP server for receiving mail as
+// described by RFC 5321.
+//
+// There is no support for authentication, TLS or relaying. The server is
+// meant to receive mail for a few local addresses, either directly on a
+// private network or forwarded by a mail transfer agent.
+package smtpd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// ErrServerClosed is returned by Serve after Shutdown was called.
+var ErrServerClosed = errors.New("smtpd: server closed")
+
+const (
+	defaultMaxSize = 10 << 20
+	defaultTimeout = 5 * time.Minute
+	// maxRecipients is the minimum amount of recipients a server must accept.
+	maxRecipients = 100
+	// maxLine is the maximum length of a command line including CRLF.
+	maxLine = 512
+	// maxErrors is the amount of failed commands after which a client is
+	// disconnected.
+	maxErrors = 10
+)
+
+// Error is an SMTP reply to a failed command, e.g. returned by Accept or
+// Deliver to reject a message permanently.
+type Error struct {
+	Code    int    // reply code, e.g. 550
+	Message string // text including an enhanced status code, e.g. "5.1.1 unknown user"
+}
+
+func (e *Error) Error() string {
+	return strconv.Itoa(e.Code) + " " + e.Message
+}
+
+// Server receives mail.
+type Server struct {
+	// Addr is the TCP address to listen on, e.g. ":25".
+	Addr string
+	// Domain is the name of the server sent in greetings.
+	Domain string
+	// MaxSize is the maximum size of a message in bytes. Defaults to 10 MiB.
+	MaxSize int64
+	// Timeout is the time a client may take to send a command or message.
+	// Defaults to five minutes.
+	Timeout time.Duration
+	// Accept returns an error if mail for rcpt must be rejected. An *Error
+	// is sent as is, others are reported as temporary failure.
+	Accept func(rcpt string) error
+	// Deliver is called for every received message. Errors are reported
+	// like those of Accept.
+	Deliver func(from string, to []string, data []byte) error
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool // true if the session is idle
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ListenAndServe listens on Addr and serves clients until Shutdown is
+// called.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l until Shutdown is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.conns = make(map[net.Conn]bool)
+	s.mu.Unlock()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			defer s.forget(c)
+			s.serveConn(c)
+		}()
+	}
+}
+
+// Shutdown stops accepting clients and closes idle sessions. It waits for
+// messages that are being received until ctx is done, then closes all
+// remaining sessions.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for c, idle := range s.conns {
+		if idle {
+			c.Close()
+		}
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) forget(c net.Conn) {
+	c.Close()
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// setIdle marks a session as waiting for a command, so it can be closed by
+// Shutdown. false is returned if the server is shutting down.
+func (s *Server) setIdle(c net.Conn, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c] = idle
+	return !s.closed
+}
+
+func (s *Server) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return defaultMaxSize
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultTimeout
+}
+
+// session is the state of a single client connection.
+type session struct {
+	srv  *Server
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	l    *log.Entry
+
+	helo string
+	from *string // nil until MAIL
+	to   []string
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	sess := &session{
+		srv:  s,
+		conn: c,
+		r:    bufio.NewReaderSize(c, maxLine),
+		w:    bufio.NewWriter(c),
+		l:    log.WithField("remote_addr", c.RemoteAddr().String()),
+	}
+	sess.reply(220, s.Domain+" ESMTP ready")
+	errs := 0
+	for {
+		if !s.setIdle(c, true) {
+			sess.reply(421, "4.3.2 shutting down")
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(s.timeout()))
+		line, err := sess.readLine()
+		var code int
+		switch {
+		case err == errLineTooLong:
+			code = sess.reply(500, "5.5.2 line too long")
+		case err != nil:
+			return
+		default:
+			s.setIdle(c, false)
+			verb, arg := line, ""
+			if i := strings.IndexByte(line, ' '); i >= 0 {
+				verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+			}
+			code = sess.handle(strings.ToUpper(verb), arg)
+		}
+		if code == 221 || code == 421 {
+			return
+		}
+		if code >= 500 {
+			errs++
+			if errs >= maxErrors {
+				sess.reply(421, "4.7.0 too many errors")
+				return
+			}
+		}
+	}
+}
+
+// handle runs a command and returns the reply code.
+func (sess *session) handle(verb, arg string) int {
+	switch verb {
+	case "HELO", "EHLO":
+		if arg == "" {
+			return sess.reply(501, "5.5.4 domain required")
+		}
+		sess.reset()
+		sess.helo = arg
+		if verb == "HELO" {
+			return sess.reply(250, sess.srv.Domain)
+		}
+		return sess.reply(250,
+			sess.srv.Domain,
+			"8BITMIME",
+			"PIPELINING",
+			"SIZE "+strconv.FormatInt(sess.srv.maxSize(), 10),
+			"ENHANCEDSTATUSCODES",
+		)
+	case "MAIL":
+		return sess.mail(arg)
+	case "RCPT":
+		return sess.rcpt(arg)
+	case "DATA":
+		return sess.data()
+	case "RSET":
+		sess.reset()
+		return sess.reply(250, "2.0.0 OK")
+	case "NOOP":
+		return sess.reply(250, "2.0.0 OK")
+	case "VRFY":
+		return sess.reply(252, "2.5.0 cannot verify user")
+	case "QUIT":
+		return sess.reply(221, "2.0.0 bye")
+	}
+	return sess.reply(502, "5.5.1 command not implemented")
+}
+
+func (sess *session) reset() {
+	sess.from = nil
+	sess.to = nil
+}
+
+func (sess *session) mail(arg string) int {
+	if sess.helo == "" {
+		return sess.reply(503, "5.5.1 send HELO or EHLO first")
+	}
+	if sess.from != nil {
+		return sess.reply(503, "5.5.1 nested MAIL command")
+	}
+	path, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		return sess.reply(501, "5.5.4 syntax: MAIL FROM:<address>")
+	}
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		if strings.EqualFold(kv[0], "SIZE") && len(kv) == 2 {
+			size, err := strconv.ParseInt(kv[1], 10, 64)
+			if err == nil && size > sess.srv.maxSize() {
+				return sess.reply(552, "5.3.4 message too big")
+			}
+		}
+	}
+	sess.from = &path
+	return sess.reply(250, "2.1.0 OK")
+}
+
+func (sess *session) rcpt(arg string) int {
+	if sess.from == nil {
+		return sess.reply(503, "5.5.1 send MAIL first")
+	}
+	path, _, ok := parsePath(arg, "TO:")
+	if !ok || path == "" {
+		return sess.reply(501, "5.5.4 syntax: RCPT TO:<address>")
+	}
+	if len(sess.to) >= maxRecipients {
+		return sess.reply(452, "4.5.3 too many recipients")
+	}
+	if sess.srv.Accept != nil {
+		if err := sess.srv.Accept(path); err != nil {
+			return sess.replyError(err)
+		}
+	}
+	sess.to = append(sess.to, path)
+	return sess.reply(250, "2.1.5 OK")
+}
+
+func (sess *session) data() int {
+	if sess.from == nil {
+		return sess.reply(503, "5.5.1 send MAIL first")
+	}
+	if len(sess.to) == 0 {
+		return sess.reply(554, "5.5.1 no valid recipients")
+	}
+	sess.reply(354, "end data with <CR><LF>.<CR><LF>")
+	sess.conn.SetReadDeadline(time.Now().Add(sess.srv.timeout()))
+	data, err := sess.readData()
+	from, to := *sess.from, sess.to
+	sess.reset()
+	if err == errTooBig {
+		return sess.reply(552, "5.3.4 message too big")
+	}
+	if err != nil {
+		return 421
+	}
+	if sess.srv.Deliver != nil {
+		if err := sess.srv.Deliver(from, to, data); err != nil {
+			return sess.replyError(err)
+		}
+	}
+	return sess.reply(250, "2.0.0 OK")
+}
+
+// replyError sends the reply of an error returned by Accept or Deliver.
+func (sess *session) replyError(err error) int {
+	if e, ok := err.(*Error); ok {
+		return sess.reply(e.Code, e.Message)
+	}
+	sess.l.WithError(err).Error("SMTP server error")
+	return sess.reply(451, "4.3.0 local error")
+}
+
+// reply sends a possibly multi-line reply and returns its code.
+func (sess *session) reply(code int, lines ...string) int {
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		fmt.Fprintf(sess.w, "%d%s%s\r\n", code, sep, l)
+	}
+	sess.w.Flush()
+	return code
+}
+
+var (
+	errLineTooLong = errors.New("line too long")
+	errTooBig      = errors.New("message too big")
+)
+
+// readLine returns a command line without line ending.
+func (sess *session) readLine() (string, error) {
+	line, err := sess.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// discard the rest of the line
+		for err == bufio.ErrBufferFull {
+			_, err = sess.r.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readData reads a message up to the terminating dot line. Dots at the
+// start of lines are unstuffed and line endings are normalized to CRLF. The
+// rest of a message exceeding MaxSize is read but discarded.
+func (sess *session) readData() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	max := sess.srv.maxSize()
+	tooBig := false
+	// discarded is true if the start of the current line was dropped, so
+	// its tail is neither a terminating nor a stuffed dot
+	discarded := false
+	var line []byte
+	for {
+		part, err := sess.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if !tooBig {
+				line = append(line, part...)
+				tooBig = int64(len(line)) > max
+			}
+			if tooBig {
+				discarded = true
+				line = line[:0]
+			}
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if discarded {
+			discarded = false
+			continue
+		}
+		line = append(line, part...)
+		text := bytes.TrimRight(line, "\r\n")
+		line = line[:0]
+		if len(text) == 1 && text[0] == '.' {
+			break
+		}
+		if len(text) > 0 && text[0] == '.' {
+			text = text[1:]
+		}
+		if tooBig {
+			continue
+		}
+		if int64(buf.Len()+len(text)+2) > max {
+			tooBig = true
+			buf.Reset()
+			continue
+		}
+		buf.Write(text)
+		buf.WriteString("\r\n")
+	}
+	if tooBig {
+		return nil, errTooBig
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePath parses the argument of MAIL or RCPT, e.g. "FROM:<a@b> SIZE=10",
+// returning the address and parameters.
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	path := arg[1:end]
+	// strip obsolete source routes, e.g. <@a,@b:user@c>
+	if strings.HasPrefix(path, "@") {
+		if i := strings.IndexByte(path, ':'); i >= 0 {
+			path = path[i+1:]
+		}
+	}
+	return path, strings.Fields(arg[end+1:]), true
+}
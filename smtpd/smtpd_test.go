@@ -0,0 +1,217 @@
+package smtpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type message struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// testServer serves mail for feeds@localhost on a loopback address and
+// returns the address and a function returning the delivered messages.
+func testServer(t *testing.T, maxSize int64) (string, func() []message) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var msgs []message
+	s := &Server{
+		Domain:  "localhost",
+		MaxSize: maxSize,
+		Accept: func(rcpt string) error {
+			if rcpt != "feeds@localhost" {
+				return &Error{Code: 550, Message: "5.1.1 unknown user"}
+			}
+			return nil
+		},
+		Deliver: func(from string, to []string, data []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			msgs = append(msgs, message{from, to, data})
+			return nil
+		},
+	}
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(l)
+	}()
+	t.Cleanup(func() {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve returned %v, want ErrServerClosed", err)
+		}
+	})
+	return l.Addr().String(), func() []message {
+		mu.Lock()
+		defer mu.Unlock()
+		return msgs
+	}
+}
+
+// testMessage returns a message with a text part and an attachment.
+func testMessage(t *testing.T) []byte {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("Hello,\r\n.leading dot\r\n.\r\nlast line\r\n"))
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/octet-stream"},
+		"Content-Disposition":       {`attachment; filename="data.bin"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0, 1, 2, 255}, 16)) + "\r\n"))
+	mw.Close()
+	return []byte("From: sender@example.com\r\n" +
+		"To: feeds@localhost\r\n" +
+		"Subject: Test\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n" +
+		"\r\n" +
+		body.String())
+}
+
+func TestServe(t *testing.T) {
+	addr, delivered := testServer(t, 0)
+	msg := testMessage(t)
+	err := smtp.SendMail(addr, nil, "sender@example.com", []string{"feeds@localhost"}, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := delivered()
+	if len(msgs) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.from != "sender@example.com" || len(m.to) != 1 || m.to[0] != "feeds@localhost" {
+		t.Errorf("envelope %q %q", m.from, m.to)
+	}
+	if !bytes.Equal(m.data, msg) {
+		t.Errorf("delivered\n%s\nwant\n%s", m.data, msg)
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	addr, delivered := testServer(t, 1024)
+	tests := []struct {
+		name string
+		to   string
+		data []byte
+		code int
+	}{
+		{"unknown recipient", "nobody@localhost", []byte("Subject: Test\r\n\r\nHello\r\n"), 550},
+		{"too big", "feeds@localhost", bytes.Repeat([]byte("0123456789abcdef\r\n"), 100), 552},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := smtp.SendMail(addr, nil, "sender@example.com", []string{test.to}, test.data)
+			if e, ok := err.(*textproto.Error); !ok || e.Code != test.code {
+				t.Errorf("error %v, want code %d", err, test.code)
+			}
+		})
+	}
+	if msgs := delivered(); len(msgs) != 0 {
+		t.Errorf("%d messages delivered, want none", len(msgs))
+	}
+}
+
+func TestServeOverlongLine(t *testing.T) {
+	addr, delivered := testServer(t, 100)
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cmd := func(code int, format string, args ...interface{}) {
+		t.Helper()
+		id, err := conn.Cmd(format, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.StartResponse(id)
+		defer conn.EndResponse(id)
+		if _, _, err = conn.ReadResponse(code); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+	}
+	if _, _, err = conn.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	cmd(250, "EHLO localhost")
+	cmd(250, "MAIL FROM:<sender@example.com>")
+	cmd(250, "RCPT TO:<feeds@localhost>")
+	cmd(354, "DATA")
+	// the tail of the line after a full read buffer is a single dot, which
+	// must not end the message
+	cmd(552, "%s.\r\nQUIT\r\n.", strings.Repeat("x", maxLine))
+	cmd(250, "NOOP")
+	if msgs := delivered(); len(msgs) != 0 {
+		t.Errorf("%d messages delivered, want none", len(msgs))
+	}
+}
+
+func TestServeTooManyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"unknown commands", "FOO"},
+		{"overlong lines", strings.Repeat("x", 2*maxLine)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr, _ := testServer(t, 0)
+			c, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.SetDeadline(time.Now().Add(5 * time.Second))
+			conn := textproto.NewConn(c)
+			defer conn.Close()
+			if _, _, err = conn.ReadResponse(220); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i < maxErrors; i++ {
+				if err = conn.PrintfLine("%s", test.line); err != nil {
+					t.Fatal(err)
+				}
+				if code, _, _ := conn.ReadResponse(0); code < 500 {
+					t.Fatalf("reply %d to error %d", code, i)
+				}
+			}
+			if err = conn.PrintfLine("%s", test.line); err != nil {
+				t.Fatal(err)
+			}
+			conn.ReadResponse(0)
+			if _, _, err = conn.ReadResponse(421); err != nil {
+				t.Fatalf("after %d errors: %v, want 421", maxErrors, err)
+			}
+			if _, err = conn.ReadLine(); err == nil {
+				t.Error("connection still open")
+			}
+		})
+	}
+}